@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+const (
+	apiShutdownTimeout = 5 * time.Second
+	apiKeepalivePeriod = 15 * time.Second
+	apiEventQueueSize  = 64
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+type apiNode struct {
+	Online    bool      `json:"online"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	MAC       string    `json:"mac"`
+	IP        string    `json:"ip"`
+	Vendor    string    `json:"vendor"`
+	DNS       string    `json:"dns"`
+	NBNS      string    `json:"nbns"`
+	MDNS      string    `json:"mdns"`
+	Gateway   bool      `json:"gateway"`
+	Interface string    `json:"interface"`
+	VLAN      uint16    `json:"vlan"`
+	Method    string    `json:"method"`
+	Sightings int       `json:"sightings"`
+	Services  []string  `json:"services"`
+
+	// status of the name requests, indexed by method
+	Probes map[string]apiProbe `json:"probes"`
+
+	// filled when an inventory is provided
+	Inventory string `json:"inventory,omitempty"`
+	Label     string `json:"label,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	Mismatch  string `json:"mismatch,omitempty"`
+}
+
+func newAPINode(n discover.Node, inv *inventory) apiNode {
+	an := apiNode{
+		Online:    n.Online,
+		FirstSeen: n.FirstSeen,
+		LastSeen:  n.LastSeen,
+		MAC:       n.MAC.String(),
+		IP:        n.IP.String(),
+		Vendor:    discover.MacVendor(n.MAC),
+		DNS:       n.DNS,
+		NBNS:      n.NBNS,
+		MDNS:      n.MDNS,
+		Gateway:   n.Gateway,
+		Interface: n.Interface,
+		VLAN:      n.VLAN,
+		Method:    n.Method,
+		Sightings: n.Sightings,
+		Services:  n.Services,
+		Probes: map[string]apiProbe{
+			"dns":  newAPIProbe(n.Probes.DNS),
+			"mdns": newAPIProbe(n.Probes.MDNS),
+			"nbns": newAPIProbe(n.Probes.NBNS),
+		},
+	}
+
+	if inv != nil {
+		m := inv.match(n)
+		an.Inventory = m.status.String()
+		an.Mismatch = m.reason
+		if m.knownMAC {
+			an.Label = m.device.Label
+			an.Owner = m.device.Owner
+		}
+	}
+
+	return an
+}
+
+type apiProbe struct {
+	State       string     `json:"state"`
+	Attempts    int        `json:"attempts"`
+	LastAttempt *time.Time `json:"lastAttempt,omitempty"`
+}
+
+func newAPIProbe(ps discover.ProbeStatus) apiProbe {
+	ap := apiProbe{
+		State:    ps.State.String(),
+		Attempts: ps.Attempts,
+	}
+	if !ps.LastAttempt.IsZero() {
+		ap.LastAttempt = &ps.LastAttempt
+	}
+	return ap
+}
+
+type apiAlert struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+	IP        string    `json:"ip,omitempty"`
+	MACs      []string  `json:"macs"`
+	Interface string    `json:"interface"`
+	VLAN      uint16    `json:"vlan"`
+}
+
+func newAPIAlert(a discover.Alert) apiAlert {
+	aa := apiAlert{
+		Time:      a.Time,
+		Kind:      a.Kind.String(),
+		Message:   a.Message,
+		Interface: a.Interface,
+		VLAN:      a.VLAN,
+		MACs:      make([]string, len(a.MACs)),
+	}
+
+	if a.IP != nil {
+		aa.IP = a.IP.String()
+	}
+
+	for i, mac := range a.MACs {
+		aa.MACs[i] = mac.String()
+	}
+
+	return aa
+}
+
+type apiDHCPServer struct {
+	LastSeen  time.Time `json:"lastSeen"`
+	MAC       string    `json:"mac"`
+	IP        string    `json:"ip"`
+	Vendor    string    `json:"vendor"`
+	Subnet    string    `json:"subnet"`
+	Gateway   string    `json:"gateway"`
+	DNS       []string  `json:"dns"`
+	Allowed   bool      `json:"allowed"`
+	Interface string    `json:"interface"`
+	VLAN      uint16    `json:"vlan"`
+}
+
+func newAPIDHCPServer(srv discover.DHCPServer) apiDHCPServer {
+	as := apiDHCPServer{
+		LastSeen:  srv.LastSeen,
+		MAC:       srv.MAC.String(),
+		IP:        srv.IP.String(),
+		Vendor:    discover.MacVendor(srv.MAC),
+		DNS:       make([]string, len(srv.DNS)),
+		Allowed:   srv.Allowed,
+		Interface: srv.Interface,
+		VLAN:      srv.VLAN,
+	}
+
+	if srv.Subnet != nil {
+		as.Subnet = srv.Subnet.String()
+	}
+
+	if srv.Gateway != nil {
+		as.Gateway = srv.Gateway.String()
+	}
+
+	for i, ip := range srv.DNS {
+		as.DNS[i] = ip.String()
+	}
+
+	return as
+}
+
+type apiEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Node     apiNode   `json:"node"`
+	Previous *apiNode  `json:"previous,omitempty"`
+	Alert    *apiAlert `json:"alert,omitempty"`
+}
+
+func newAPIEvent(evt discover.Event, inv *inventory) apiEvent {
+	aevt := apiEvent{
+		Type: evt.Type.String(),
+		Time: time.Now(),
+		Node: newAPINode(evt.Node, inv),
+	}
+
+	if evt.Previous != nil {
+		prev := newAPINode(*evt.Previous, inv)
+		aevt.Previous = &prev
+	}
+
+	if evt.Alert != nil {
+		alert := newAPIAlert(*evt.Alert)
+		aevt.Alert = &alert
+	}
+
+	return aevt
+}
+
+// eventHub distributes scanner events to subscribers.
+// Events are dropped for subscribers that are not keeping up.
+type eventHub struct {
+	mutex sync.Mutex
+	subs  map[chan apiEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subs: make(map[chan apiEvent]struct{}),
+	}
+}
+
+func (h *eventHub) publish(aevt apiEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for sub := range h.subs {
+		select {
+		case sub <- aevt:
+		default:
+		}
+	}
+}
+
+func (h *eventHub) subscribe() chan apiEvent {
+	sub := make(chan apiEvent, apiEventQueueSize)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub chan apiEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.subs, sub)
+}
+
+// apiScanner is the part of the scanner used by the HTTP API.
+type apiScanner interface {
+	Nodes() []discover.Node
+	Alerts() []discover.Alert
+	DHCPServers() []discover.DHCPServer
+	Stats() discover.Stats
+	Scan() error
+}
+
+// apiServer exposes the node table through HTTP.
+type apiServer struct {
+	s   apiScanner
+	inv *inventory
+	hub *eventHub
+	ln  net.Listener
+	mux *http.ServeMux
+}
+
+func newAPIServer(address string, s apiScanner, inv *inventory, hub *eventHub) (*apiServer, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &apiServer{
+		s:   s,
+		inv: inv,
+		hub: hub,
+		ln:  ln,
+		mux: http.NewServeMux(),
+	}
+
+	a.mux.HandleFunc("/", a.onDashboard)
+	a.mux.HandleFunc("/nodes", a.onNodes)
+	a.mux.HandleFunc("/nodes/", a.onNode)
+	a.mux.HandleFunc("/alerts", a.onAlerts)
+	a.mux.HandleFunc("/dhcp", a.onDHCP)
+	a.mux.HandleFunc("/events", a.onEvents)
+	a.mux.HandleFunc("/scan", a.onScan)
+	a.mux.HandleFunc("/metrics", a.onMetrics)
+
+	return a, nil
+}
+
+// run serves requests until the context is canceled.
+func (a *apiServer) run(ctx context.Context) error {
+	srv := &http.Server{
+		Handler:           a.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			// close event streams when terminating
+			return ctx
+		},
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(a.ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx) //nolint:errcheck
+		<-serveErr
+		return nil
+	}
+}
+
+func (a *apiServer) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
+
+func (a *apiServer) writeError(w http.ResponseWriter, code int, err error) {
+	a.writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func (a *apiServer) nodes() []apiNode {
+	nodes := a.s.Nodes()
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if c := bytes.Compare(nodes[i].IP, nodes[j].IP); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(nodes[i].MAC, nodes[j].MAC) < 0
+	})
+
+	ret := make([]apiNode, len(nodes))
+	for i, n := range nodes {
+		ret[i] = newAPINode(n, a.inv)
+	}
+
+	return ret
+}
+
+func (a *apiServer) onDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		a.writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML) //nolint:errcheck
+}
+
+func (a *apiServer) onNodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, a.nodes())
+}
+
+func (a *apiServer) onNode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	mac, err := net.ParseMAC(strings.TrimPrefix(r.URL.Path, "/nodes/"))
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid MAC address"))
+		return
+	}
+
+	// a MAC can be associated with multiple IPs; the most recent one is returned
+	var ret *apiNode
+	nodes := a.nodes()
+	for i, n := range nodes {
+		if n.MAC == mac.String() && (ret == nil || n.LastSeen.After(ret.LastSeen)) {
+			ret = &nodes[i]
+		}
+	}
+
+	if ret == nil {
+		a.writeError(w, http.StatusNotFound, fmt.Errorf("node not found"))
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, ret)
+}
+
+func (a *apiServer) onAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	alerts := a.s.Alerts()
+
+	ret := make([]apiAlert, len(alerts))
+	for i, alert := range alerts {
+		ret[i] = newAPIAlert(alert)
+	}
+
+	a.writeJSON(w, http.StatusOK, ret)
+}
+
+func (a *apiServer) onDHCP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	servers := a.s.DHCPServers()
+
+	sort.Slice(servers, func(i, j int) bool {
+		return bytes.Compare(servers[i].IP, servers[j].IP) < 0
+	})
+
+	ret := make([]apiDHCPServer, len(servers))
+	for i, srv := range servers {
+		ret[i] = newAPIDHCPServer(srv)
+	}
+
+	a.writeJSON(w, http.StatusOK, ret)
+}
+
+func (a *apiServer) onEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		a.writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	sub := a.hub.subscribe()
+	defer a.hub.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(apiKeepalivePeriod)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case evt := <-sub:
+			byts, err := json.Marshal(evt)
+			if err != nil {
+				return
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", evt.Type, byts)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-keepalive.C:
+			_, err := fmt.Fprintf(w, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (a *apiServer) onScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	// browsers let any web page send POST requests without a custom content type
+	// to the LAN, therefore the JSON content type is required, and cross-origin
+	// requests, that are preflighted, are rejected.
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt != "application/json" {
+		a.writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/json"))
+		return
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			a.writeError(w, http.StatusForbidden, fmt.Errorf("cross-origin requests are not allowed"))
+			return
+		}
+	}
+
+	err := a.s.Scan()
+	if err != nil {
+		a.writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+type fakeAPIScanner struct {
+	nodes   []discover.Node
+	stats   discover.Stats
+	scanErr error
+	scans   int
+}
+
+func (s *fakeAPIScanner) Nodes() []discover.Node {
+	return append([]discover.Node(nil), s.nodes...)
+}
+
+func (s *fakeAPIScanner) Alerts() []discover.Alert {
+	return nil
+}
+
+func (s *fakeAPIScanner) DHCPServers() []discover.DHCPServer {
+	return nil
+}
+
+func (s *fakeAPIScanner) Stats() discover.Stats {
+	return s.stats
+}
+
+func (s *fakeAPIScanner) Scan() error {
+	s.scans++
+	return s.scanErr
+}
+
+func mustParseMAC(t *testing.T, v string) net.HardwareAddr {
+	mac, err := net.ParseMAC(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mac
+}
+
+func newTestAPIServer(t *testing.T, s apiScanner) (*apiServer, *httptest.Server) {
+	a, err := newAPIServer("127.0.0.1:0", s, nil, newEventHub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.ln.Close()
+
+	srv := httptest.NewServer(a.mux)
+	t.Cleanup(srv.Close)
+
+	return a, srv
+}
+
+func testAPINodes(t *testing.T) []discover.Node {
+	now := time.Now()
+	return []discover.Node{
+		{
+			MAC:       mustParseMAC(t, "00:11:22:33:44:55"),
+			IP:        net.ParseIP("192.168.1.20").To4(),
+			LastSeen:  now.Add(-time.Minute),
+			Online:    true,
+			Interface: "eth0",
+		},
+		{
+			MAC:      mustParseMAC(t, "66:77:88:99:aa:bb"),
+			IP:       net.ParseIP("192.168.1.10").To4(),
+			LastSeen: now,
+			Online:   true,
+			NBNS:     "printer",
+		},
+		{
+			MAC:      mustParseMAC(t, "00:11:22:33:44:55"),
+			IP:       net.ParseIP("192.168.1.30").To4(),
+			LastSeen: now,
+			Online:   true,
+		},
+	}
+}
+
+func TestAPINodes(t *testing.T) {
+	_, srv := newTestAPIServer(t, &fakeAPIScanner{nodes: testAPINodes(t)})
+
+	res, err := http.Get(srv.URL + "/nodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", res.StatusCode)
+	}
+
+	var nodes []apiNode
+	err = json.NewDecoder(res.Body).Decode(&nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nodes are sorted by IP
+	var ips []string
+	for _, n := range nodes {
+		ips = append(ips, n.IP)
+	}
+	if strings.Join(ips, ",") != "192.168.1.10,192.168.1.20,192.168.1.30" {
+		t.Errorf("unexpected nodes: %v", ips)
+	}
+
+	if nodes[0].NBNS != "printer" || nodes[0].Probes["nbns"].State != "none" {
+		t.Errorf("unexpected node: %+v", nodes[0])
+	}
+
+	res2, err := http.Post(srv.URL+"/nodes", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res2.Body.Close()
+	if res2.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status code: %d", res2.StatusCode)
+	}
+}
+
+func TestAPINode(t *testing.T) {
+	_, srv := newTestAPIServer(t, &fakeAPIScanner{nodes: testAPINodes(t)})
+
+	for _, ca := range []struct {
+		name string
+		path string
+		code int
+		ip   string
+	}{
+		{
+			"found",
+			"/nodes/66:77:88:99:aa:bb",
+			http.StatusOK,
+			"192.168.1.10",
+		},
+		{
+			"multiple ips",
+			"/nodes/00-11-22-33-44-55",
+			http.StatusOK,
+			"192.168.1.30",
+		},
+		{
+			"not found",
+			"/nodes/00:00:00:00:00:01",
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"invalid mac",
+			"/nodes/printer",
+			http.StatusBadRequest,
+			"",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			res, err := http.Get(srv.URL + ca.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != ca.code {
+				t.Fatalf("unexpected status code: %d", res.StatusCode)
+			}
+
+			if ca.code != http.StatusOK {
+				return
+			}
+
+			var n apiNode
+			err = json.NewDecoder(res.Body).Decode(&n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.IP != ca.ip {
+				t.Errorf("unexpected node: %+v", n)
+			}
+		})
+	}
+}
+
+func TestAPIEvents(t *testing.T) {
+	a, srv := newTestAPIServer(t, &fakeAPIScanner{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type: %s", res.Header.Get("Content-Type"))
+	}
+
+	subscribers := func() int {
+		a.hub.mutex.Lock()
+		defer a.hub.mutex.Unlock()
+		return len(a.hub.subs)
+	}
+
+	// the subscription is performed before the headers are sent
+	if subscribers() != 1 {
+		t.Fatalf("unexpected subscribers: %d", subscribers())
+	}
+
+	a.hub.publish(newAPIEvent(discover.Event{
+		Type: discover.EventNew,
+		Node: testAPINodes(t)[1],
+	}, nil))
+
+	r := bufio.NewReader(res.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+
+	if lines[0] != "event: new" || lines[2] != "" {
+		t.Fatalf("unexpected event: %q", lines)
+	}
+
+	var evt apiEvent
+	err = json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evt.Type != "new" || evt.Node.IP != "192.168.1.10" {
+		t.Errorf("unexpected event: %+v", evt)
+	}
+
+	// the subscription is removed when the client disconnects
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for subscribers() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription was not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAPIScan(t *testing.T) {
+	for _, ca := range []struct {
+		name        string
+		method      string
+		contentType string
+		origin      string
+		err         error
+		code        int
+		scans       int
+	}{
+		{"accepted", http.MethodPost, "application/json", "", nil, http.StatusAccepted, 1},
+		{"charset", http.MethodPost, "application/json; charset=utf-8", "", nil, http.StatusAccepted, 1},
+		{"same origin", http.MethodPost, "application/json", "http://{host}", nil, http.StatusAccepted, 1},
+		{
+			"passive", http.MethodPost, "application/json", "",
+			fmt.Errorf("scanner is in passive mode"), http.StatusConflict, 1,
+		},
+		{"get", http.MethodGet, "", "", nil, http.StatusMethodNotAllowed, 0},
+		{"no content type", http.MethodPost, "", "", nil, http.StatusUnsupportedMediaType, 0},
+		{"form", http.MethodPost, "text/plain", "", nil, http.StatusUnsupportedMediaType, 0},
+		{"cross origin", http.MethodPost, "application/json", "http://example.com", nil, http.StatusForbidden, 0},
+		{"invalid origin", http.MethodPost, "application/json", "%", nil, http.StatusForbidden, 0},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			s := &fakeAPIScanner{scanErr: ca.err}
+			_, srv := newTestAPIServer(t, s)
+
+			req, err := http.NewRequest(ca.method, srv.URL+"/scan", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ca.contentType != "" {
+				req.Header.Set("Content-Type", ca.contentType)
+			}
+			if ca.origin != "" {
+				req.Header.Set("Origin", strings.ReplaceAll(ca.origin, "{host}", strings.TrimPrefix(srv.URL, "http://")))
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != ca.code {
+				t.Errorf("unexpected status code: %d", res.StatusCode)
+			}
+			if s.scans != ca.scans {
+				t.Errorf("unexpected scans: %d", s.scans)
+			}
+		})
+	}
+}
+
+// scrapeMetrics returns the samples of /metrics, indexed by name and labels,
+// and the HELP and TYPE lines.
+func scrapeMetrics(t *testing.T, url string) (map[string]string, []string) {
+	res, err := http.Get(url + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+
+	samples := make(map[string]string)
+	var comments []string
+
+	sc := bufio.NewScanner(res.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			comments = append(comments, line)
+			continue
+		}
+
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			t.Fatalf("invalid line: %s", line)
+		}
+		samples[line[:i]] = line[i+1:]
+	}
+
+	return samples, comments
+}
+
+func TestAPIMetrics(t *testing.T) {
+	s := &fakeAPIScanner{
+		nodes: testAPINodes(t),
+		stats: discover.Stats{
+			NewNodes: 3,
+			Methods: map[string]discover.MethodStats{
+				"arp":  {ProbesSent: 100, Responses: 3},
+				"nbns": {ProbesSent: 3, Responses: 1, ParseErrors: 1},
+			},
+		},
+	}
+	_, srv := newTestAPIServer(t, s)
+
+	samples, comments := scrapeMetrics(t, srv.URL)
+
+	for _, line := range []string{
+		"# HELP landiscover_nodes Number of known nodes.",
+		"# TYPE landiscover_nodes gauge",
+		"# TYPE landiscover_nodes_new_total counter",
+		"# TYPE landiscover_probes_sent_total counter",
+		"# TYPE landiscover_node_last_seen_timestamp_seconds gauge",
+	} {
+		if !slices.Contains(comments, line) {
+			t.Errorf("missing line: %s", line)
+		}
+	}
+
+	// every sample has a HELP and a TYPE line
+	for key := range samples {
+		name, _, _ := strings.Cut(key, "{")
+		if !slices.Contains(comments, "# TYPE "+name+" counter") &&
+			!slices.Contains(comments, "# TYPE "+name+" gauge") {
+			t.Errorf("missing TYPE of %s", name)
+		}
+		if !slices.ContainsFunc(comments, func(c string) bool { return strings.HasPrefix(c, "# HELP "+name+" ") }) {
+			t.Errorf("missing HELP of %s", name)
+		}
+	}
+
+	for key, value := range map[string]string{
+		"landiscover_nodes":                            "3",
+		"landiscover_nodes_online":                     "3",
+		"landiscover_nodes_new_total":                  "3",
+		`landiscover_probes_sent_total{method="arp"}`:  "100",
+		`landiscover_probes_sent_total{method="dns"}`:  "0",
+		`landiscover_responses_total{method="nbns"}`:   "1",
+		`landiscover_parse_errors_total{layer="nbns"}`: "1",
+		`landiscover_node_last_seen_timestamp_seconds{mac="00:11:22:33:44:55",` +
+			`ip="192.168.1.20",interface="eth0",name=""}`: fmt.Sprintf("%v",
+			float64(s.nodes[0].LastSeen.UnixNano())/1e9),
+	} {
+		if samples[key] != value {
+			t.Errorf("expected %s %s, got %q", key, value, samples[key])
+		}
+	}
+
+	// DNS is resolved by the system
+	if _, ok := samples[`landiscover_parse_errors_total{layer="dns"}`]; ok {
+		t.Error("unexpected DNS parse errors")
+	}
+
+	s.stats.NewNodes++
+	s.stats.FramesReceived += 10
+	s.stats.Methods["arp"] = discover.MethodStats{ProbesSent: 150, Responses: 4}
+
+	samples2, _ := scrapeMetrics(t, srv.URL)
+
+	// counters only go up
+	increased := 0
+	for key, value := range samples {
+		name, _, _ := strings.Cut(key, "{")
+		if !strings.HasSuffix(name, "_total") {
+			continue
+		}
+
+		v1, _ := strconv.ParseFloat(value, 64)
+		v2, err := strconv.ParseFloat(samples2[key], 64)
+		if err != nil || v2 < v1 {
+			t.Errorf("counter %s went from %s to %q", key, value, samples2[key])
+		}
+		if v2 > v1 {
+			increased++
+		}
+	}
+	if increased != 4 {
+		t.Errorf("unexpected increased counters: %d", increased)
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+// configFile is the content of a configuration file.
+// Keys have the same names as the command-line flags.
+type configFile struct {
+	Interface     string                `yaml:"interface" toml:"interface"`
+	Interfaces    []string              `yaml:"interfaces" toml:"interfaces"`
+	AllInterfaces bool                  `yaml:"all-interfaces" toml:"all-interfaces"`
+	Passive       bool                  `yaml:"passive" toml:"passive"`
+	Methods       []string              `yaml:"methods" toml:"methods"`
+	Ranges        []string              `yaml:"ranges" toml:"ranges"`
+	VLANs         []string              `yaml:"vlans" toml:"vlans"`
+	Gateway       string                `yaml:"gateway" toml:"gateway"`
+	DHCP          configDHCP            `yaml:"dhcp" toml:"dhcp"`
+	Rates         map[string]configRate `yaml:"rates" toml:"rates"`
+	GlobalRate    configRate            `yaml:"global-rate" toml:"global-rate"`
+	ScanInterval  time.Duration         `yaml:"scan-interval" toml:"scan-interval"`
+	Retries       int                   `yaml:"retries" toml:"retries"`
+	Output        configOutput          `yaml:"output" toml:"output"`
+	Inventory     string                `yaml:"inventory" toml:"inventory"`
+	Hooks         configHooks           `yaml:"hooks" toml:"hooks"`
+	UI            configUI              `yaml:"ui" toml:"ui"`
+}
+
+type configDHCP struct {
+	Probe bool     `yaml:"probe" toml:"probe"`
+	Allow []string `yaml:"allow" toml:"allow"`
+}
+
+type configRate struct {
+	// a pointer is needed since zero disables the limit
+	Rate  *float64 `yaml:"rate" toml:"rate"`
+	Burst int      `yaml:"burst" toml:"burst"`
+}
+
+type configOutput struct {
+	Headless bool   `yaml:"headless" toml:"headless"`
+	Listen   string `yaml:"listen" toml:"listen"`
+}
+
+type configHooks struct {
+	Webhook     string `yaml:"webhook" toml:"webhook"`
+	OnNewDevice string `yaml:"on-new-device" toml:"on-new-device"`
+	AsRoot      bool   `yaml:"as-root" toml:"as-root"`
+}
+
+type configUI struct {
+	Columns []string `yaml:"columns" toml:"columns"`
+}
+
+// defaultConfigPaths returns the paths where the configuration file is searched
+// when it is not provided, by order of precedence.
+func defaultConfigPaths() []string {
+	var ret []string
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		ret = append(ret,
+			filepath.Join(dir, "landiscover", "landiscover.yml"),
+			filepath.Join(dir, "landiscover", "landiscover.toml"))
+	}
+
+	return append(ret,
+		"/etc/landiscover.yml",
+		"/etc/landiscover.toml")
+}
+
+// findConfig returns the path of the configuration file, or an empty string if there's none.
+func findConfig(fpath string) (string, error) {
+	if fpath != "" {
+		return fpath, nil
+	}
+
+	for _, p := range defaultConfigPaths() {
+		_, err := os.Stat(p)
+		if err == nil {
+			return p, nil
+		}
+		// directories of other users are skipped
+		if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, os.ErrPermission) {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// loadConfig reads and validates a configuration file.
+// Files with the .toml extension are decoded as TOML, other files as YAML.
+// A relative inventory path is resolved against the directory of the file.
+func loadConfig(fpath string) (*configFile, error) {
+	byts, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg configFile
+
+	if strings.HasSuffix(fpath, ".toml") {
+		md, err := toml.Decode(string(byts), &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fpath, err)
+		}
+
+		if undecoded := md.Undecoded(); len(undecoded) != 0 {
+			return nil, fmt.Errorf("%s: unknown key: %s", fpath, undecoded[0])
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(byts))
+		dec.KnownFields(true)
+
+		// an empty file is valid
+		err := dec.Decode(&cfg)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", fpath, err)
+		}
+	}
+
+	// a relative inventory is next to the configuration file
+	if cfg.Inventory != "" && !filepath.IsAbs(cfg.Inventory) {
+		cfg.Inventory = filepath.Join(filepath.Dir(fpath), cfg.Inventory)
+	}
+
+	err = cfg.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fpath, err)
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *configFile) validate() error {
+	for _, method := range cfg.Methods {
+		if !slices.Contains([]string{"arp", "dns", "mdns", "nbns"}, method) {
+			return fmt.Errorf("methods: invalid method: %s", method)
+		}
+	}
+
+	_, err := parseRanges(cfg.Ranges)
+	if err != nil {
+		return fmt.Errorf("ranges: %w", err)
+	}
+
+	_, err = parseVLANs(cfg.VLANs)
+	if err != nil {
+		return fmt.Errorf("vlans: %w", err)
+	}
+
+	if cfg.Gateway != "" && net.ParseIP(cfg.Gateway).To4() == nil {
+		return fmt.Errorf("gateway: invalid IP: %s", cfg.Gateway)
+	}
+
+	for _, a := range cfg.DHCP.Allow {
+		if _, err := net.ParseMAC(a); err != nil && net.ParseIP(a) == nil {
+			return fmt.Errorf("dhcp: allow: invalid address: %s", a)
+		}
+	}
+
+	rates := discover.DefaultRates()
+	for method, r := range cfg.Rates {
+		if _, ok := rates[method]; !ok {
+			return fmt.Errorf("rates: invalid method: %s", method)
+		}
+		if (r.Rate != nil && *r.Rate < 0) || r.Burst < 0 {
+			return fmt.Errorf("rates: invalid rate for %s", method)
+		}
+	}
+
+	if (cfg.GlobalRate.Rate != nil && *cfg.GlobalRate.Rate < 0) || cfg.GlobalRate.Burst < 0 {
+		return fmt.Errorf("invalid rate for global-rate")
+	}
+
+	if cfg.Inventory != "" {
+		_, err := loadInventory(cfg.Inventory)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = validateColumns(cfg.UI.Columns)
+	if err != nil {
+		return fmt.Errorf("ui: %w", err)
+	}
+
+	return nil
+}
+
+// apply copies the values of the file into the flags that were not provided
+// on the command line.
+func (cfg *configFile) apply(sc *scanCmd, set map[string]bool) {
+	// interfaces provided on the command line replace the ones of the file
+	if len(sc.Interfaces) == 0 && !set["all-interfaces"] {
+		if cfg.Interface != "" {
+			sc.Interfaces = append(sc.Interfaces, cfg.Interface)
+		}
+		sc.Interfaces = append(sc.Interfaces, cfg.Interfaces...)
+
+		if cfg.AllInterfaces {
+			sc.AllInterfaces = true
+		}
+	}
+
+	if !set["passive"] && cfg.Passive {
+		sc.Passive = true
+	}
+
+	if !set["methods"] && cfg.Methods != nil {
+		sc.Methods = cfg.Methods
+	}
+
+	if !set["range"] && cfg.Ranges != nil {
+		sc.Range = cfg.Ranges
+	}
+
+	if !set["vlan"] && cfg.VLANs != nil {
+		sc.VLAN = cfg.VLANs
+	}
+
+	if !set["gateway"] && cfg.Gateway != "" {
+		sc.Gateway = cfg.Gateway
+	}
+
+	if !set["dhcp-probe"] && cfg.DHCP.Probe {
+		sc.DHCPProbe = true
+	}
+
+	if !set["dhcp-allow"] && cfg.DHCP.Allow != nil {
+		sc.DHCPAllow = cfg.DHCP.Allow
+	}
+
+	// rates are merged by method
+	for method, r := range cfg.Rates {
+		if _, ok := sc.Rate[method]; !ok && r.Rate != nil {
+			if sc.Rate == nil {
+				sc.Rate = make(map[string]float64)
+			}
+			sc.Rate[method] = *r.Rate
+		}
+
+		if _, ok := sc.Burst[method]; !ok && r.Burst != 0 {
+			if sc.Burst == nil {
+				sc.Burst = make(map[string]int)
+			}
+			sc.Burst[method] = r.Burst
+		}
+	}
+
+	if !set["global-rate"] && cfg.GlobalRate.Rate != nil {
+		sc.GlobalRate = *cfg.GlobalRate.Rate
+	}
+
+	if !set["global-burst"] && cfg.GlobalRate.Burst != 0 {
+		sc.GlobalBurst = cfg.GlobalRate.Burst
+	}
+
+	if !set["scan-interval"] && cfg.ScanInterval != 0 {
+		sc.ScanInterval = cfg.ScanInterval
+	}
+
+	if !set["retries"] && cfg.Retries != 0 {
+		sc.Retries = cfg.Retries
+	}
+
+	if !set["headless"] && cfg.Output.Headless {
+		sc.Headless = true
+	}
+
+	if !set["listen"] && cfg.Output.Listen != "" {
+		sc.Listen = cfg.Output.Listen
+	}
+
+	if !set["inventory"] && cfg.Inventory != "" {
+		sc.Inventory = cfg.Inventory
+	}
+
+	if !set["webhook"] && cfg.Hooks.Webhook != "" {
+		sc.Webhook = cfg.Hooks.Webhook
+	}
+
+	if !set["on-new-device"] && cfg.Hooks.OnNewDevice != "" {
+		sc.OnNewDevice = cfg.Hooks.OnNewDevice
+	}
+
+	if !set["hooks-as-root"] && cfg.Hooks.AsRoot {
+		sc.HooksAsRoot = true
+	}
+
+	if !set["columns"] && cfg.UI.Columns != nil {
+		sc.Columns = cfg.UI.Columns
+	}
+}
+
+// parseRanges parses subnets in CIDR notation.
+func parseRanges(ranges []string) ([]*net.IPNet, error) {
+	var ret []*net.IPNet
+
+	for _, r := range ranges {
+		ip, ipnet, err := net.ParseCIDR(r)
+		if err != nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid range: %s", r)
+		}
+		ret = append(ret, ipnet)
+	}
+
+	return ret, nil
+}
+
+// parseRates merges rates and bursts of methods into the default rates.
+func parseRates(pps map[string]float64, bursts map[string]int) (map[string]discover.Rate, error) {
+	rates := discover.DefaultRates()
+
+	for method, v := range pps {
+		r, ok := rates[method]
+		if !ok {
+			return nil, fmt.Errorf("invalid method: %s", method)
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("invalid rate for %s: %v", method, v)
+		}
+		r.PacketsPerSecond = v
+		rates[method] = r
+	}
+
+	for method, v := range bursts {
+		r, ok := rates[method]
+		if !ok {
+			return nil, fmt.Errorf("invalid method: %s", method)
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("invalid rate for %s: burst %d", method, v)
+		}
+		r.Burst = v
+		rates[method] = r
+	}
+
+	return rates, nil
+}
+
+// parseVLANs parses VLANs in the ID:CIDR format.
+// Ranges of the same VLAN are merged.
+func parseVLANs(vlans []string) ([]discover.VLAN, error) {
+	var ret []discover.VLAN
+
+	for _, v := range vlans {
+		idStr, cidr, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid VLAN: %s", v)
+		}
+
+		id, err := strconv.ParseUint(idStr, 10, 16)
+		if err != nil || id == 0 || id > 4094 {
+			return nil, fmt.Errorf("invalid VLAN: %s", v)
+		}
+
+		ranges, err := parseRanges([]string{cidr})
+		if err != nil {
+			return nil, fmt.Errorf("invalid VLAN: %s", v)
+		}
+
+		i := slices.IndexFunc(ret, func(v discover.VLAN) bool { return v.ID == uint16(id) })
+		if i < 0 {
+			ret = append(ret, discover.VLAN{ID: uint16(id)})
+			i = len(ret) - 1
+		}
+		ret[i].Ranges = append(ret[i].Ranges, ranges...)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+func writeTestFile(t *testing.T, fpath string, content string) {
+	err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(fpath, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	rate := func(v float64) *float64 { return &v }
+
+	expected := configFile{
+		Interfaces:   []string{"eth0"},
+		Methods:      []string{"arp", "nbns"},
+		Ranges:       []string{"192.168.1.0/24"},
+		Gateway:      "192.168.1.1",
+		Rates:        map[string]configRate{"arp": {Rate: rate(50), Burst: 2}},
+		ScanInterval: 30 * time.Second,
+		Output:       configOutput{Listen: ":8080"},
+		UI:           configUI{Columns: []string{"mac", "ip"}},
+	}
+
+	for _, ca := range []struct {
+		name    string
+		file    string
+		content string
+		cfg     *configFile
+		err     string
+	}{
+		{
+			"yaml",
+			"landiscover.yml",
+			"interfaces: [eth0]\n" +
+				"methods: [arp, nbns]\n" +
+				"ranges: [192.168.1.0/24]\n" +
+				"gateway: 192.168.1.1\n" +
+				"rates:\n" +
+				"  arp: {rate: 50, burst: 2}\n" +
+				"scan-interval: 30s\n" +
+				"output:\n" +
+				"  listen: \":8080\"\n" +
+				"ui:\n" +
+				"  columns: [mac, ip]\n",
+			&expected,
+			"",
+		},
+		{
+			"toml",
+			"landiscover.toml",
+			"interfaces = [\"eth0\"]\n" +
+				"methods = [\"arp\", \"nbns\"]\n" +
+				"ranges = [\"192.168.1.0/24\"]\n" +
+				"gateway = \"192.168.1.1\"\n" +
+				"scan-interval = \"30s\"\n" +
+				"[rates.arp]\n" +
+				"rate = 50\n" +
+				"burst = 2\n" +
+				"[output]\n" +
+				"listen = \":8080\"\n" +
+				"[ui]\n" +
+				"columns = [\"mac\", \"ip\"]\n",
+			&expected,
+			"",
+		},
+		{
+			"yaml empty",
+			"landiscover.yml",
+			"",
+			&configFile{},
+			"",
+		},
+		{
+			"yaml unknown key",
+			"landiscover.yml",
+			"interfaces: [eth0]\nintervals: 30s\n",
+			nil,
+			"field intervals not found",
+		},
+		{
+			"toml unknown key",
+			"landiscover.toml",
+			"interfaces = [\"eth0\"]\n[output]\nlisen = \":8080\"\n",
+			nil,
+			"unknown key: output.lisen",
+		},
+		{
+			"invalid method",
+			"landiscover.yml",
+			"methods: [icmp]\n",
+			nil,
+			"methods: invalid method: icmp",
+		},
+		{
+			"negative rate",
+			"landiscover.yml",
+			"rates:\n  arp:\n    rate: -1\n",
+			nil,
+			"rates: invalid rate for arp",
+		},
+		{
+			"negative burst",
+			"landiscover.toml",
+			"[rates.mdns]\nburst = -2\n",
+			nil,
+			"rates: invalid rate for mdns",
+		},
+		{
+			"negative global rate",
+			"landiscover.yml",
+			"global-rate:\n  rate: -5\n",
+			nil,
+			"invalid rate for global-rate",
+		},
+		{
+			"invalid column",
+			"landiscover.yml",
+			"ui:\n  columns: [color]\n",
+			nil,
+			"ui: ",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			fpath := filepath.Join(t.TempDir(), ca.file)
+			writeTestFile(t, fpath, ca.content)
+
+			cfg, err := loadConfig(fpath)
+
+			if ca.err != "" {
+				if err == nil || !strings.Contains(err.Error(), ca.err) {
+					t.Fatalf("expected error containing %q, got %v", ca.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, ca.cfg) {
+				t.Errorf("unexpected configuration: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigInventory(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "inventory.yml"), "devices:\n- mac: 00:11:22:33:44:55\n")
+
+	for _, ca := range []struct {
+		name      string
+		inventory string
+	}{
+		{"relative", "inventory.yml"},
+		{"absolute", filepath.Join(dir, "inventory.yml")},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			fpath := filepath.Join(dir, "landiscover.yml")
+			writeTestFile(t, fpath, "inventory: "+ca.inventory+"\n")
+
+			cfg, err := loadConfig(fpath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Inventory != filepath.Join(dir, "inventory.yml") {
+				t.Errorf("unexpected inventory: %s", cfg.Inventory)
+			}
+		})
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	rate := func(v float64) *float64 { return &v }
+
+	cfg := configFile{
+		Interface:    "eth0",
+		Passive:      true,
+		Methods:      []string{"arp"},
+		Gateway:      "192.168.1.1",
+		Rates:        map[string]configRate{"arp": {Rate: rate(50), Burst: 2}, "mdns": {Rate: rate(1)}},
+		ScanInterval: 30 * time.Second,
+		Output:       configOutput{Listen: ":8080"},
+		Hooks:        configHooks{AsRoot: true},
+		UI:           configUI{Columns: []string{"mac", "ip"}},
+	}
+
+	for _, ca := range []struct {
+		name string
+		cli  scanCmd
+		set  map[string]bool
+		out  scanCmd
+	}{
+		{
+			"file only",
+			scanCmd{ScanInterval: 10 * time.Second},
+			map[string]bool{},
+			scanCmd{
+				Interfaces:   []string{"eth0"},
+				Passive:      true,
+				Methods:      []string{"arp"},
+				Gateway:      "192.168.1.1",
+				Rate:         map[string]float64{"arp": 50, "mdns": 1},
+				Burst:        map[string]int{"arp": 2},
+				ScanInterval: 30 * time.Second,
+				Listen:       ":8080",
+				HooksAsRoot:  true,
+				Columns:      []string{"mac", "ip"},
+			},
+		},
+		{
+			"flags take precedence",
+			scanCmd{
+				Interfaces:   []string{"eth1"},
+				Methods:      []string{"nbns"},
+				Rate:         map[string]float64{"arp": 10},
+				ScanInterval: 10 * time.Second,
+				Listen:       ":9090",
+			},
+			map[string]bool{
+				"passive":       true,
+				"methods":       true,
+				"rate":          true,
+				"scan-interval": true,
+				"listen":        true,
+				"hooks-as-root": true,
+				"columns":       true,
+			},
+			scanCmd{
+				Interfaces:   []string{"eth1"},
+				Methods:      []string{"nbns"},
+				Gateway:      "192.168.1.1",
+				Rate:         map[string]float64{"arp": 10, "mdns": 1},
+				Burst:        map[string]int{"arp": 2},
+				ScanInterval: 10 * time.Second,
+				Listen:       ":9090",
+			},
+		},
+		{
+			"all interfaces flag",
+			scanCmd{AllInterfaces: true},
+			map[string]bool{"all-interfaces": true},
+			scanCmd{
+				AllInterfaces: true,
+				Passive:       true,
+				Methods:       []string{"arp"},
+				Gateway:       "192.168.1.1",
+				Rate:          map[string]float64{"arp": 50, "mdns": 1},
+				Burst:         map[string]int{"arp": 2},
+				ScanInterval:  30 * time.Second,
+				Listen:        ":8080",
+				HooksAsRoot:   true,
+				Columns:       []string{"mac", "ip"},
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			sc := ca.cli
+			cfg.apply(&sc, ca.set)
+
+			if !reflect.DeepEqual(sc, ca.out) {
+				t.Errorf("unexpected flags: %+v", sc)
+			}
+		})
+	}
+}
+
+func TestParseRates(t *testing.T) {
+	for _, ca := range []struct {
+		name   string
+		pps    map[string]float64
+		bursts map[string]int
+		arp    discover.Rate
+		err    string
+	}{
+		{
+			"defaults",
+			nil,
+			nil,
+			discover.DefaultRates()["arp"],
+			"",
+		},
+		{
+			"merged",
+			map[string]float64{"arp": 50},
+			map[string]int{"arp": 4},
+			discover.Rate{PacketsPerSecond: 50, Burst: 4},
+			"",
+		},
+		{
+			"no limit",
+			map[string]float64{"arp": 0},
+			nil,
+			discover.Rate{PacketsPerSecond: 0, Burst: 1},
+			"",
+		},
+		{
+			"invalid method",
+			map[string]float64{"icmp": 1},
+			nil,
+			discover.Rate{},
+			"invalid method: icmp",
+		},
+		{
+			"negative rate",
+			map[string]float64{"arp": -1},
+			nil,
+			discover.Rate{},
+			"invalid rate for arp: -1",
+		},
+		{
+			"negative burst",
+			nil,
+			map[string]int{"nbns": -1},
+			discover.Rate{},
+			"invalid rate for nbns: burst -1",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			rates, err := parseRates(ca.pps, ca.bursts)
+
+			if ca.err != "" {
+				if err == nil || err.Error() != ca.err {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rates["arp"] != ca.arp {
+				t.Errorf("unexpected rate: %+v", rates["arp"])
+			}
+		})
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	paths := defaultConfigPaths()
+	expected := []string{
+		filepath.Join(dir, "landiscover", "landiscover.yml"),
+		filepath.Join(dir, "landiscover", "landiscover.toml"),
+		"/etc/landiscover.yml",
+		"/etc/landiscover.toml",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+
+	fpath, err := findConfig("/path/to/config.yml")
+	if err != nil || fpath != "/path/to/config.yml" {
+		t.Errorf("unexpected result: %s, %v", fpath, err)
+	}
+
+	// the TOML file is used when there's no YAML file
+	writeTestFile(t, expected[1], "")
+	fpath, err = findConfig("")
+	if err != nil || fpath != expected[1] {
+		t.Errorf("unexpected result: %s, %v", fpath, err)
+	}
+
+	writeTestFile(t, expected[0], "")
+	fpath, err = findConfig("")
+	if err != nil || fpath != expected[0] {
+		t.Errorf("unexpected result: %s, %v", fpath, err)
+	}
+}
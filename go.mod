@@ -3,13 +3,12 @@ module github.com/aler9/landiscover
 go 1.21.0
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/alecthomas/kong v1.8.1
 	github.com/google/gopacket v1.1.19
+	github.com/mattn/go-runewidth v0.0.9
 	github.com/nsf/termbox-go v1.1.1
-)
-
-require (
-	github.com/mattn/go-runewidth v0.0.9 // indirect
-	golang.org/x/net v0.33.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/sync v0.10.0
+	golang.org/x/sys v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+const (
+	hookQueueSize     = 256
+	webhookTimeout    = 10 * time.Second
+	webhookAttempts   = 4
+	webhookRetryPause = 1 * time.Second
+	execHookTimeout   = 30 * time.Second
+)
+
+// checkHookPrivileges refuses to run the exec hook as root, unless allowed.
+// Capabilities are dropped after startup, but a process of root regains
+// all of them when it executes a command.
+func checkHookPrivileges(onNewDevice string, asRoot bool, euid int) error {
+	if onNewDevice != "" && euid == 0 && !asRoot {
+		return fmt.Errorf("--on-new-device would run the command as root: run landiscover " +
+			"as an unprivileged user with CAP_NET_RAW, or add --hooks-as-root")
+	}
+	return nil
+}
+
+// hookRunner notifies external systems about node events.
+// Hooks are run sequentially by a dedicated goroutine, in order not to block the scanner.
+type hookRunner struct {
+	webhookURL  string
+	onNewDevice string
+	onError     func(error)
+
+	retryPause  time.Duration
+	execTimeout time.Duration
+	client      *http.Client
+	queue       chan apiEvent
+}
+
+func newHookRunner(webhookURL string, onNewDevice string, onError func(error)) *hookRunner {
+	return &hookRunner{
+		webhookURL:  webhookURL,
+		onNewDevice: onNewDevice,
+		onError:     onError,
+		retryPause:  webhookRetryPause,
+		execTimeout: execHookTimeout,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+		},
+		queue: make(chan apiEvent, hookQueueSize),
+	}
+}
+
+// push enqueues an event. It never blocks.
+func (h *hookRunner) push(evt apiEvent) {
+	select {
+	case h.queue <- evt:
+	default:
+		h.onError(fmt.Errorf("hook queue is full, event discarded"))
+	}
+}
+
+// run runs hooks until the context is canceled.
+func (h *hookRunner) run(ctx context.Context) error {
+	for {
+		select {
+		case evt := <-h.queue:
+			if h.webhookURL != "" {
+				err := h.sendWebhook(ctx, evt)
+				if err != nil && ctx.Err() == nil {
+					h.onError(fmt.Errorf("webhook: %w", err))
+				}
+			}
+
+			if h.onNewDevice != "" && evt.Type == discover.EventNew.String() {
+				err := h.execNewDevice(ctx, evt)
+				if err != nil && ctx.Err() == nil {
+					h.onError(fmt.Errorf("on-new-device: %w", err))
+				}
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// sendWebhook posts the event to the webhook URL, retrying with exponential backoff.
+func (h *hookRunner) sendWebhook(ctx context.Context, evt apiEvent) error {
+	byts, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	pause := h.retryPause
+
+	for attempt := 1; ; attempt++ {
+		err = h.postWebhook(ctx, evt.Type, byts)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		pause *= 2
+	}
+}
+
+func (h *hookRunner) postWebhook(ctx context.Context, evtType string, byts []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.webhookURL, bytes.NewReader(byts))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "landiscover/"+version)
+	req.Header.Set("X-Landiscover-Event", evtType)
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("bad status code: %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// execNewDevice runs the command with the node in environment variables and as JSON on stdin.
+func (h *hookRunner) execNewDevice(ctx context.Context, evt apiEvent) error {
+	byts, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.execTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", h.onNewDevice)
+	cmd.Stdin = bytes.NewReader(byts)
+	cmd.Env = append(os.Environ(),
+		"LANDISCOVER_EVENT="+evt.Type,
+		"LANDISCOVER_MAC="+evt.Node.MAC,
+		"LANDISCOVER_IP="+evt.Node.IP,
+		"LANDISCOVER_INTERFACE="+evt.Node.Interface,
+		"LANDISCOVER_VLAN="+strconv.Itoa(int(evt.Node.VLAN)),
+		"LANDISCOVER_VENDOR="+evt.Node.Vendor,
+		"LANDISCOVER_DNS="+evt.Node.DNS,
+		"LANDISCOVER_NBNS="+evt.Node.NBNS,
+		"LANDISCOVER_MDNS="+evt.Node.MDNS,
+		"LANDISCOVER_INVENTORY="+evt.Node.Inventory,
+		"LANDISCOVER_LABEL="+evt.Node.Label,
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testWebhookRequest struct {
+	time   time.Time
+	header http.Header
+	body   []byte
+}
+
+// testWebhookReceiver replies to requests with the given status codes, then with 200.
+type testWebhookReceiver struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	codes    []int
+	requests []testWebhookRequest
+}
+
+func newTestWebhookReceiver(t *testing.T, codes ...int) *testWebhookReceiver {
+	r := &testWebhookReceiver{codes: codes}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.requests = append(r.requests, testWebhookRequest{
+			time:   time.Now(),
+			header: req.Header,
+			body:   body,
+		})
+
+		code := http.StatusOK
+		if len(r.codes) != 0 {
+			code = r.codes[0]
+			r.codes = r.codes[1:]
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func (r *testWebhookReceiver) received() []testWebhookRequest {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]testWebhookRequest(nil), r.requests...)
+}
+
+func testHookEvent() apiEvent {
+	return apiEvent{
+		Type: "new",
+		Node: apiNode{
+			MAC:       "00:11:22:33:44:55",
+			IP:        "192.168.1.20",
+			Interface: "eth0",
+			VLAN:      10,
+			NBNS:      "printer",
+		},
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	for _, ca := range []struct {
+		name     string
+		codes    []int
+		requests int
+		err      string
+	}{
+		{
+			"success",
+			nil,
+			1,
+			"",
+		},
+		{
+			"retried",
+			[]int{http.StatusInternalServerError, http.StatusServiceUnavailable},
+			3,
+			"",
+		},
+		{
+			"failed",
+			[]int{500, 500, 500, 500, 500},
+			webhookAttempts,
+			"bad status code: 500",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			r := newTestWebhookReceiver(t, ca.codes...)
+
+			h := newHookRunner(r.URL, "", nil)
+			h.retryPause = 20 * time.Millisecond
+
+			err := h.sendWebhook(context.Background(), testHookEvent())
+
+			if ca.err != "" {
+				if err == nil || err.Error() != ca.err {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err != nil {
+				t.Error(err)
+			}
+
+			reqs := r.received()
+			if len(reqs) != ca.requests {
+				t.Fatalf("expected %d requests, got %d", ca.requests, len(reqs))
+			}
+
+			// the pause doubles after every attempt
+			for i := 1; i < len(reqs); i++ {
+				pause := h.retryPause << (i - 1)
+				if d := reqs[i].time.Sub(reqs[i-1].time); d < pause {
+					t.Errorf("attempt %d was sent after %v, expected at least %v", i+1, d, pause)
+				}
+			}
+
+			for _, req := range reqs {
+				if req.header.Get("Content-Type") != "application/json" ||
+					req.header.Get("X-Landiscover-Event") != "new" {
+					t.Errorf("unexpected headers: %v", req.header)
+				}
+
+				var evt apiEvent
+				err := json.Unmarshal(req.body, &evt)
+				if err != nil || evt.Node.MAC != "00:11:22:33:44:55" {
+					t.Errorf("unexpected body: %s", req.body)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookCanceled(t *testing.T) {
+	r := newTestWebhookReceiver(t, 500, 500, 500, 500)
+
+	h := newHookRunner(r.URL, "", nil)
+	h.retryPause = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for len(r.received()) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+
+	err := h.sendWebhook(ctx, testHookEvent())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestExecHook(t *testing.T) {
+	dir := t.TempDir()
+	envPath := filepath.Join(dir, "env")
+	stdinPath := filepath.Join(dir, "stdin")
+
+	h := newHookRunner("", `printf '%s|%s|%s|%s|%s|%s|%s|%s' `+
+		`"$LANDISCOVER_EVENT" "$LANDISCOVER_MAC" "$LANDISCOVER_IP" "$LANDISCOVER_INTERFACE" `+
+		`"$LANDISCOVER_VLAN" "$LANDISCOVER_NBNS" "$LANDISCOVER_DNS" "$LANDISCOVER_INVENTORY" > `+envPath+
+		` && cat > `+stdinPath, nil)
+
+	err := h.execNewDevice(context.Background(), testHookEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := os.ReadFile(envPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(env) != "new|00:11:22:33:44:55|192.168.1.20|eth0|10|printer||" {
+		t.Errorf("unexpected environment: %s", env)
+	}
+
+	stdin, err := os.ReadFile(stdinPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var evt apiEvent
+	err = json.Unmarshal(stdin, &evt)
+	if err != nil || evt.Type != "new" || evt.Node.IP != "192.168.1.20" {
+		t.Errorf("unexpected stdin: %s", stdin)
+	}
+}
+
+func TestExecHookErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		cmd  string
+		err  string
+	}{
+		{
+			"exit code",
+			"echo failure >&2; exit 3",
+			"exit status 3: failure",
+		},
+		{
+			"timeout",
+			"exec sleep 10",
+			"signal: killed",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			h := newHookRunner("", ca.cmd, nil)
+			h.execTimeout = 100 * time.Millisecond
+
+			start := time.Now()
+			err := h.execNewDevice(context.Background(), testHookEvent())
+
+			if err == nil || !strings.HasPrefix(err.Error(), ca.err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Error("the command was not stopped")
+			}
+		})
+	}
+}
+
+func TestCheckHookPrivileges(t *testing.T) {
+	for _, ca := range []struct {
+		name        string
+		onNewDevice string
+		asRoot      bool
+		euid        int
+		ok          bool
+	}{
+		{"unprivileged", "notify.sh", false, 1000, true},
+		{"root", "notify.sh", false, 0, false},
+		{"root allowed", "notify.sh", true, 0, true},
+		{"root without hook", "", false, 0, true},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			err := checkHookPrivileges(ca.onNewDevice, ca.asRoot, ca.euid)
+			if (err == nil) != ca.ok {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+type inventoryStatus int
+
+const (
+	inventoryUnknown inventoryStatus = iota
+	inventoryKnown
+	inventoryMismatch
+)
+
+func (s inventoryStatus) String() string {
+	switch s {
+	case inventoryKnown:
+		return "known"
+	case inventoryMismatch:
+		return "mismatch"
+	}
+	return "unknown"
+}
+
+type inventoryDevice struct {
+	MAC   string   `yaml:"mac"`
+	Label string   `yaml:"label"`
+	Owner string   `yaml:"owner,omitempty"`
+	IPs   []string `yaml:"ips,omitempty"`
+	Names []string `yaml:"names,omitempty"`
+
+	mac net.HardwareAddr
+	ips []net.IP
+}
+
+type inventoryFile struct {
+	Devices []*inventoryDevice `yaml:"devices"`
+}
+
+// inventoryMatch is the result of checking a node against the inventory.
+type inventoryMatch struct {
+	status inventoryStatus
+
+	// device associated with the MAC address of the node, or with one of its names.
+	device *inventoryDevice
+
+	// reason of a mismatch.
+	reason string
+
+	// whether the MAC address of the node is in the inventory.
+	knownMAC bool
+}
+
+// inventory is a list of approved devices.
+type inventory struct {
+	fpath string
+	byMAC map[string]*inventoryDevice
+
+	mutex  sync.Mutex
+	byName map[string]*inventoryDevice
+}
+
+func loadInventory(fpath string) (*inventory, error) {
+	byts, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var f inventoryFile
+	err = yaml.Unmarshal(byts, &f)
+	if err != nil {
+		return nil, fmt.Errorf("inventory: %w", err)
+	}
+
+	inv, err := newInventory(f.Devices)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.fpath = fpath
+	return inv, nil
+}
+
+func newInventory(devices []*inventoryDevice) (*inventory, error) {
+	inv := &inventory{
+		byMAC:  make(map[string]*inventoryDevice),
+		byName: make(map[string]*inventoryDevice),
+	}
+
+	for i, d := range devices {
+		var err error
+		d.mac, err = net.ParseMAC(d.MAC)
+		if err != nil {
+			return nil, fmt.Errorf("inventory: device %d: invalid MAC address '%s'", i+1, d.MAC)
+		}
+
+		if _, ok := inv.byMAC[d.mac.String()]; ok {
+			return nil, fmt.Errorf("inventory: device %d: duplicate MAC address '%s'", i+1, d.MAC)
+		}
+
+		for _, v := range d.IPs {
+			ip := net.ParseIP(v).To4()
+			if ip == nil {
+				return nil, fmt.Errorf("inventory: device %d: invalid IPv4 address '%s'", i+1, v)
+			}
+			d.ips = append(d.ips, ip)
+		}
+
+		if d.Label == "" {
+			d.Label = d.mac.String()
+		}
+
+		inv.byMAC[d.mac.String()] = d
+
+		for _, name := range d.Names {
+			inv.byName[strings.ToLower(name)] = d
+		}
+	}
+
+	return inv, nil
+}
+
+// hostname returns the best name of a node: the DNS name, that is usually
+// assigned by the network, then the names chosen by the node itself.
+func hostname(n discover.Node) string {
+	switch {
+	case n.DNS != "":
+		return n.DNS
+	case n.MDNS != "":
+		return n.MDNS
+	}
+	return n.NBNS
+}
+
+func nodeNames(n discover.Node) []string {
+	var ret []string
+	for _, name := range []string{n.DNS, n.NBNS, n.MDNS} {
+		if name != "" {
+			ret = append(ret, strings.ToLower(name))
+		}
+	}
+	return ret
+}
+
+// learn remembers the names of a known device, in order to detect them on other MAC addresses.
+func (inv *inventory) learn(n discover.Node) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	if d, ok := inv.byMAC[n.MAC.String()]; ok {
+		inv.learnNames(d, n)
+	}
+}
+
+func (inv *inventory) learnNames(d *inventoryDevice, n discover.Node) {
+	for _, name := range nodeNames(n) {
+		if _, ok := inv.byName[name]; !ok {
+			inv.byName[name] = d
+		}
+	}
+}
+
+// match checks a node against the inventory.
+func (inv *inventory) match(n discover.Node) inventoryMatch {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	if d, ok := inv.byMAC[n.MAC.String()]; ok {
+		if len(d.ips) != 0 {
+			found := false
+			for _, ip := range d.ips {
+				if bytes.Equal(ip, n.IP.To4()) {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return inventoryMatch{
+					status:   inventoryMismatch,
+					device:   d,
+					reason:   fmt.Sprintf("unexpected IP, expected %s", strings.Join(d.IPs, ", ")),
+					knownMAC: true,
+				}
+			}
+		}
+
+		return inventoryMatch{
+			status:   inventoryKnown,
+			device:   d,
+			knownMAC: true,
+		}
+	}
+
+	for _, name := range nodeNames(n) {
+		if d, ok := inv.byName[name]; ok {
+			return inventoryMatch{
+				status: inventoryMismatch,
+				device: d,
+				reason: fmt.Sprintf("name %s belongs to %s", name, d.mac),
+			}
+		}
+	}
+
+	return inventoryMatch{
+		status: inventoryUnknown,
+	}
+}
+
+// add adds a node to the inventory as a known device, and appends it to the inventory file.
+// The file is edited as a YAML tree, in order to preserve comments and formatting.
+func (inv *inventory) add(n discover.Node, label string) error {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	if _, ok := inv.byMAC[n.MAC.String()]; ok {
+		return fmt.Errorf("%s is already in the inventory", n.MAC)
+	}
+
+	d := &inventoryDevice{
+		MAC:   n.MAC.String(),
+		Label: label,
+		mac:   n.MAC,
+	}
+	if d.Label == "" {
+		d.Label = d.MAC
+	}
+
+	byts, err := os.ReadFile(inv.fpath)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	err = yaml.Unmarshal(byts, &doc)
+	if err != nil {
+		return fmt.Errorf("inventory: %w", err)
+	}
+
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode}},
+		}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("inventory: unexpected content")
+	}
+
+	var devices *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "devices" {
+			devices = root.Content[i+1]
+		}
+	}
+
+	switch {
+	case devices == nil:
+		devices = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "devices"}, devices)
+
+	case devices.Kind == yaml.ScalarNode && devices.Tag == "!!null":
+		*devices = yaml.Node{Kind: yaml.SequenceNode}
+
+	case devices.Kind != yaml.SequenceNode:
+		return fmt.Errorf("inventory: devices is not a list")
+	}
+
+	var dn yaml.Node
+	err = dn.Encode(d)
+	if err != nil {
+		return err
+	}
+	devices.Content = append(devices.Content, &dn)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(&doc)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(inv.fpath, buf.Bytes(), 0o644)
+	if err != nil {
+		return err
+	}
+
+	inv.byMAC[d.MAC] = d
+	inv.learnNames(d, n)
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+func newTestInventory(t *testing.T) *inventory {
+	fpath := filepath.Join(t.TempDir(), "inventory.yml")
+	writeTestFile(t, fpath, "devices:\n"+
+		"- mac: 00:11:22:33:44:55\n"+
+		"  label: printer\n"+
+		"  ips: [192.168.1.20]\n"+
+		"  names: [Printer.local]\n"+
+		"- mac: 66:77:88:99:aa:bb\n"+
+		"  label: nas\n")
+
+	inv, err := loadInventory(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+func testInventoryNode(t *testing.T, mac string, ip string, mdns string) discover.Node {
+	return discover.Node{
+		MAC:  mustParseMAC(t, mac),
+		IP:   net.ParseIP(ip).To4(),
+		MDNS: mdns,
+	}
+}
+
+func TestInventoryMatch(t *testing.T) {
+	inv := newTestInventory(t)
+
+	for _, ca := range []struct {
+		name     string
+		node     discover.Node
+		status   inventoryStatus
+		label    string
+		knownMAC bool
+		reason   string
+	}{
+		{
+			"mac",
+			testInventoryNode(t, "00:11:22:33:44:55", "192.168.1.20", ""),
+			inventoryKnown,
+			"printer",
+			true,
+			"",
+		},
+		{
+			"mac without ips",
+			testInventoryNode(t, "66:77:88:99:AA:BB", "192.168.1.99", ""),
+			inventoryKnown,
+			"nas",
+			true,
+			"",
+		},
+		{
+			"unexpected ip",
+			testInventoryNode(t, "00:11:22:33:44:55", "192.168.1.21", ""),
+			inventoryMismatch,
+			"printer",
+			true,
+			"unexpected IP, expected 192.168.1.20",
+		},
+		{
+			"name of another device",
+			testInventoryNode(t, "00:00:00:00:00:01", "192.168.1.22", "printer.local"),
+			inventoryMismatch,
+			"printer",
+			false,
+			"name printer.local belongs to 00:11:22:33:44:55",
+		},
+		{
+			"unknown",
+			testInventoryNode(t, "00:00:00:00:00:01", "192.168.1.20", "laptop.local"),
+			inventoryUnknown,
+			"",
+			false,
+			"",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			m := inv.match(ca.node)
+
+			if m.status != ca.status || m.knownMAC != ca.knownMAC || m.reason != ca.reason {
+				t.Errorf("unexpected match: %+v", m)
+			}
+
+			label := ""
+			if m.device != nil {
+				label = m.device.Label
+			}
+			if label != ca.label {
+				t.Errorf("unexpected label: %s", label)
+			}
+		})
+	}
+}
+
+func TestInventoryLearn(t *testing.T) {
+	inv := newTestInventory(t)
+
+	known := testInventoryNode(t, "66:77:88:99:aa:bb", "192.168.1.30", "NAS.local")
+	other := testInventoryNode(t, "00:00:00:00:00:01", "192.168.1.31", "nas.local")
+
+	// matching does not learn names
+	inv.match(known)
+	if m := inv.match(other); m.status != inventoryUnknown {
+		t.Fatalf("unexpected match: %+v", m)
+	}
+
+	// names of unknown devices are not learned
+	inv.learn(other)
+	if m := inv.match(other); m.status != inventoryUnknown {
+		t.Fatalf("unexpected match: %+v", m)
+	}
+
+	inv.learn(known)
+	m := inv.match(other)
+	if m.status != inventoryMismatch || m.reason != "name nas.local belongs to 66:77:88:99:aa:bb" {
+		t.Errorf("unexpected match: %+v", m)
+	}
+
+	// names listed in the file are not replaced by learned ones
+	inv.learn(testInventoryNode(t, "66:77:88:99:aa:bb", "192.168.1.30", "printer.local"))
+	m = inv.match(testInventoryNode(t, "00:00:00:00:00:02", "192.168.1.32", "printer.local"))
+	if m.device == nil || m.device.Label != "printer" {
+		t.Errorf("unexpected match: %+v", m)
+	}
+}
+
+func TestInventoryAdd(t *testing.T) {
+	inv := newTestInventory(t)
+
+	n := testInventoryNode(t, "00:00:00:00:00:01", "192.168.1.40", "laptop.local")
+
+	err := inv.add(n, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := inv.match(n); m.status != inventoryKnown || m.device.Label != "laptop" {
+		t.Errorf("unexpected match: %+v", m)
+	}
+
+	err = inv.add(n, "laptop")
+	if err == nil {
+		t.Error("a device was added twice")
+	}
+
+	// the device is appended to the file
+	inv2, err := loadInventory(inv.fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv2.byMAC) != 3 {
+		t.Errorf("unexpected devices: %d", len(inv2.byMAC))
+	}
+	if m := inv2.match(n); m.status != inventoryKnown || m.device.Label != "laptop" {
+		t.Errorf("unexpected match after reload: %+v", m)
+	}
+}
@@ -2,295 +2,339 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/aler9/landiscover/pkg/discover"
 )
 
 var version = "v0.0.0"
 
-type nodeKey struct {
-	mac [6]byte
-	ip  [4]byte
-}
-
-func newNodeKey(mac []byte, ip []byte) nodeKey {
-	key := nodeKey{}
-	copy(key.mac[:], mac)
-	copy(key.ip[:], ip)
-	return key
-}
-
-type node struct {
-	lastSeen time.Time
-	mac      net.HardwareAddr
-	ip       net.IP
-	dns      string
-	nbns     string
-	mdns     string
+type scanCmd struct {
+	Passive bool     `help:"do not send any packet." negatable:""`
+	Methods []string `help:"methods used to send requests (arp, dns, mdns, nbns)." placeholder:"METHOD"`
+	Range   []string `help:"subnet swept by ARP. Default: /24 of the interface." placeholder:"CIDR"`
+	VLAN    []string `help:"VLAN probed with tagged frames, i.e. 10:192.168.10.0/24." placeholder:"ID:CIDR"`
+
+	Headless    bool   `help:"print events to standard output instead of starting the UI." negatable:""`
+	Listen      string `help:"serve the HTTP API on this address (i.e. :8080)." placeholder:"ADDRESS"`
+	Webhook     string `help:"send node events to this URL with a JSON POST request." placeholder:"URL"`
+	OnNewDevice string `help:"run this shell command when a new device is found." placeholder:"CMD"`
+	HooksAsRoot bool   `help:"allow --on-new-device when running as root." negatable:""`
+	Inventory   string `help:"YAML file with the list of known devices." placeholder:"FILE" type:"existingfile"`
+
+	Gateway   string   `help:"IP of the gateway, whose MAC address is monitored." placeholder:"IP"`
+	DHCPProbe bool     `help:"send DHCP discover requests in order to find DHCP servers." negatable:""`
+	DHCPAllow []string `help:"MAC address or IP of a legitimate DHCP server. Can be repeated." placeholder:"ADDR"`
+
+	Rate        map[string]float64 `help:"packets per second of a method. Zero: no limit." placeholder:"METHOD=PPS"`
+	Burst       map[string]int     `help:"packets of a method that can be sent at once." placeholder:"METHOD=N"`
+	GlobalRate  float64            `help:"maximum packets per second of all methods together." placeholder:"PPS"`
+	GlobalBurst int                `help:"packets that can be sent at once by all methods." default:"1" placeholder:"N"`
+
+	ScanInterval time.Duration `help:"pause between two ARP sweeps." default:"10s"`
+	Retries      int           `help:"times an ARP request is sent again to silent IPs." placeholder:"N"`
+	Once         bool          `help:"perform a single ARP sweep and stop."`
+	GracePeriod  time.Duration `help:"in once mode, time to wait for name replies after the sweep." default:"3s"`
+
+	Columns       []string `help:"columns of the terminal interface, in order (${columns})." placeholder:"COLUMN"`
+	AllInterfaces bool     `help:"listen to every suitable interface." negatable:""`
+	Interfaces    []string `arg:"" optional:"" name:"interface" help:"interfaces to listen to. Default: the first one."`
 }
 
-type arpReq struct {
-	srcMac net.HardwareAddr
-	srcIP  net.IP
-}
+var cli struct {
+	Config string `help:"configuration file. Default: ~/.config/landiscover/landiscover.yml." placeholder:"FILE"`
 
-type dnsReq struct {
-	key nodeKey
-	dns string
-}
+	Scan scanCmd `cmd:"" default:"withargs" help:"discover devices (default command)."`
 
-type mdnsReq struct {
-	srcMac     net.HardwareAddr
-	srcIP      net.IP
-	domainName string
+	ConfigCmd struct {
+		Check struct{} `cmd:"" help:"validate the configuration file."`
+	} `cmd:"" name:"config" help:"manage the configuration file."`
 }
 
-type nbnsReq struct {
-	srcMac net.HardwareAddr
-	srcIP  net.IP
-	name   string
-}
+// printEvent prints an event to standard output.
+// The interface is printed when there are multiple interfaces,
+// the VLAN when the node is tagged.
+func printEvent(evt apiEvent, showInterface bool) {
+	n := evt.Node
+	intf := ""
+	if showInterface {
+		intf = "  interface=" + n.Interface
+	}
+	if n.VLAN != 0 {
+		intf += fmt.Sprintf("  vlan=%d", n.VLAN)
+	}
 
-type uiGetDataReq struct {
-	resNodes chan map[nodeKey]*node
-	done     chan struct{}
-}
+	if evt.Alert != nil {
+		fmt.Printf("%-8s %s  %-15s  %s: %s%s\n",
+			evt.Type,
+			n.MAC,
+			n.IP,
+			evt.Alert.Kind,
+			evt.Alert.Message,
+			intf)
+		return
+	}
+	line := fmt.Sprintf("%-8s %s  %-15s  %s  dns=%s nbns=%s mdns=%s",
+		evt.Type,
+		n.MAC,
+		n.IP,
+		n.Vendor,
+		orDash(n.DNS),
+		orDash(n.NBNS),
+		orDash(n.MDNS))
+
+	if n.Inventory != "" {
+		line += fmt.Sprintf("  inventory=%s label=%q", n.Inventory, n.Label)
+		if n.Mismatch != "" {
+			line += fmt.Sprintf(" mismatch=%q", n.Mismatch)
+		}
+	}
 
-type program struct {
-	passiveMode bool
-	intf        *net.Interface
-	ownIP       net.IP
-	ls          *listener
-	ma          *methodArp
-	mm          *methodMdns
-	mn          *methodNbns
-	ui          *ui
-
-	arp       chan arpReq
-	dns       chan dnsReq
-	mdns      chan mdnsReq
-	nbns      chan nbnsReq
-	uiGetData chan uiGetDataReq
-	terminate chan struct{}
+	fmt.Println(line + intf)
 }
 
-var cli struct {
-	Passive   bool   `help:"do not send any packet."`
-	Interface string `arg:"" help:"Interface to listen to."`
+func orDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
 }
 
-func newProgram() error {
-	kong.Parse(&cli,
+func run() error {
+	kctx := kong.Parse(&cli,
 		kong.Description("landiscover "+version),
+		kong.Vars{"columns": strings.Join(uiColumnNames(), ", ")},
 		kong.UsageOnError())
 
-	if os.Getuid() != 0 {
-		return fmt.Errorf("you must be root")
+	fpath, err := findConfig(cli.Config)
+	if err != nil {
+		return err
 	}
 
-	layerNbnsInit()
-	layerMdnsInit()
+	if kctx.Command() == "config check" {
+		if fpath == "" {
+			return fmt.Errorf("no configuration file found in %s", strings.Join(defaultConfigPaths(), ", "))
+		}
 
-	intfName, err := func() (string, error) {
-		if len(cli.Interface) != 0 {
-			return cli.Interface, nil
+		_, err := loadConfig(fpath)
+		if err != nil {
+			return err
 		}
 
-		return defaultInterfaceName()
-	}()
-	if err != nil {
-		return err
+		fmt.Printf("%s is valid\n", fpath)
+		return nil
 	}
 
-	intf, err := func() (*net.Interface, error) {
-		res, err2 := net.InterfaceByName(intfName)
-		if err2 != nil {
-			return nil, fmt.Errorf("invalid interface: %s", intfName)
+	if fpath != "" {
+		cfg, err := loadConfig(fpath)
+		if err != nil {
+			return err
 		}
 
-		if (res.Flags & net.FlagBroadcast) == 0 {
-			return nil, fmt.Errorf("interface does not support broadcast")
+		// flags provided on the command line override the file
+		set := make(map[string]bool)
+		for _, p := range kctx.Path {
+			if p.Flag != nil {
+				set[p.Flag.Name] = true
+			}
 		}
 
-		return res, nil
-	}()
-	if err != nil {
-		return err
+		cfg.apply(&cli.Scan, set)
 	}
 
-	ownIP, err := func() (net.IP, error) {
-		addrs, err2 := intf.Addrs()
-		if err2 != nil {
-			return nil, err2
-		}
+	return runScan(&cli.Scan)
+}
 
-		for _, a := range addrs {
-			if ipn, ok := a.(*net.IPNet); ok {
-				if ip4 := ipn.IP.To4(); ip4 != nil {
-					if bytes.Equal(ipn.Mask, []byte{255, 255, 255, 0}) {
-						return ip4, nil
-					}
-				}
-			}
+func runScan(cli *scanCmd) error {
+	// the terminal interface is disabled in headless and daemon mode
+	useUI := !cli.Headless && cli.Listen == ""
+
+	var inv *inventory
+	if cli.Inventory != "" {
+		var err error
+		inv, err = loadInventory(cli.Inventory)
+		if err != nil {
+			return err
 		}
+	}
+
+	// set when a MAC address that is not in the inventory is found
+	var unknownFound atomic.Bool
 
-		return nil, fmt.Errorf("no valid ip found")
-	}()
+	var hub *eventHub
+	if cli.Listen != "" {
+		hub = newEventHub()
+	}
+
+	err := checkHookPrivileges(cli.OnNewDevice, cli.HooksAsRoot, os.Geteuid())
 	if err != nil {
 		return err
 	}
 
-	p := &program{
-		passiveMode: cli.Passive,
-		intf:        intf,
-		ownIP:       ownIP,
-		arp:         make(chan arpReq),
-		dns:         make(chan dnsReq),
-		mdns:        make(chan mdnsReq),
-		nbns:        make(chan nbnsReq),
-		uiGetData:   make(chan uiGetDataReq),
-		terminate:   make(chan struct{}),
+	var hooks *hookRunner
+	if cli.Webhook != "" || cli.OnNewDevice != "" {
+		hooks = newHookRunner(cli.Webhook, cli.OnNewDevice, func(err error) {
+			// do not break the terminal interface
+			if !useUI {
+				fmt.Fprintln(os.Stderr, "WAR:", err)
+			}
+		})
 	}
 
-	err = newListener(p)
+	err = validateColumns(cli.Columns)
 	if err != nil {
 		return err
 	}
 
-	err = newMethodArp(p)
+	ranges, err := parseRanges(cli.Range)
 	if err != nil {
 		return err
 	}
 
-	err = newMethodMdns(p)
+	vlans, err := parseVLANs(cli.VLAN)
 	if err != nil {
 		return err
 	}
 
-	err = newMethodNbns(p)
-	if err != nil {
-		return err
+	var gateway net.IP
+	if cli.Gateway != "" {
+		gateway = net.ParseIP(cli.Gateway).To4()
+		if gateway == nil {
+			return fmt.Errorf("invalid gateway: %s", cli.Gateway)
+		}
 	}
 
-	err = newUI(p)
+	rates, err := parseRates(cli.Rate, cli.Burst)
 	if err != nil {
 		return err
 	}
 
-	p.run()
-
-	return nil
-}
+	if cli.GlobalRate < 0 || cli.GlobalBurst < 0 {
+		return fmt.Errorf("invalid rate for global-rate")
+	}
 
-func (p *program) run() {
-	go p.ls.run()
-	go p.ma.run()
-	go p.mm.run()
-	go p.mn.run()
-	go p.ui.run()
-
-	nodes := make(map[nodeKey]*node)
-
-outer:
-	for {
-		select {
-		case req := <-p.arp:
-			key := newNodeKey(req.srcMac, req.srcIP)
-
-			if _, ok := nodes[key]; !ok {
-				nodes[key] = &node{
-					lastSeen: time.Now(),
-					mac:      req.srcMac,
-					ip:       req.srcIP,
+	opts := discover.Options{
+		Interfaces:         cli.Interfaces,
+		AllInterfaces:      cli.AllInterfaces,
+		Passive:            cli.Passive,
+		Methods:            cli.Methods,
+		Ranges:             ranges,
+		VLANs:              vlans,
+		Gateway:            gateway,
+		DHCPProbe:          cli.DHCPProbe,
+		AllowedDHCPServers: cli.DHCPAllow,
+		Rates:              rates,
+		GlobalRate: discover.Rate{
+			PacketsPerSecond: cli.GlobalRate,
+			Burst:            cli.GlobalBurst,
+		},
+		ScanInterval: cli.ScanInterval,
+		Retries:      cli.Retries,
+		Once:         cli.Once,
+		GracePeriod:  cli.GracePeriod,
+		OnEvent: func(evt discover.Event) {
+			if inv != nil {
+				inv.learn(evt.Node)
+				if !inv.match(evt.Node).knownMAC {
+					unknownFound.Store(true)
 				}
+			}
 
-				if !p.passiveMode {
-					go p.dnsRequest(key, req.srcIP)
-					go p.mm.request(req.srcIP)
-					go p.mn.request(req.srcIP)
-				}
+			aevt := newAPIEvent(evt, inv)
 
-				// update last seen
-			} else {
-				nodes[key].lastSeen = time.Now()
+			if cli.Headless {
+				printEvent(aevt, cli.AllInterfaces || len(cli.Interfaces) > 1)
+			}
+			if hub != nil {
+				hub.publish(aevt)
 			}
+			if hooks != nil {
+				hooks.push(aevt)
+			}
+		},
+	}
 
-		case req := <-p.dns:
-			nodes[req.key].dns = req.dns
+	s, err := discover.NewScanner(opts)
+	if err != nil {
+		return err
+	}
 
-		case req := <-p.mdns:
-			key := newNodeKey(req.srcMac, req.srcIP)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-			if _, ok := nodes[key]; !ok {
-				nodes[key] = &node{
-					lastSeen: time.Now(),
-					mac:      req.srcMac,
-					ip:       req.srcIP,
-				}
-			}
+	ctx, ctxCancel := context.WithCancel(ctx)
+	defer ctxCancel()
 
-			nodes[key].lastSeen = time.Now()
-			if nodes[key].mdns != req.domainName {
-				nodes[key].mdns = req.domainName
-			}
+	g, ctx := errgroup.WithContext(ctx)
 
-		case req := <-p.nbns:
-			key := newNodeKey(req.srcMac, req.srcIP)
+	if cli.Listen != "" {
+		a, err := newAPIServer(cli.Listen, s, inv, hub)
+		if err != nil {
+			s.Close()
+			return err
+		}
 
-			if _, has := nodes[key]; !has {
-				nodes[key] = &node{
-					lastSeen: time.Now(),
-					mac:      req.srcMac,
-					ip:       req.srcIP,
-				}
-			}
+		g.Go(func() error { return a.run(ctx) })
+	}
 
-			nodes[key].lastSeen = time.Now()
-			if nodes[key].nbns != req.name {
-				nodes[key].nbns = req.name
-			}
+	err = dropPrivileges()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WAR:", err)
+	}
 
-		case req := <-p.uiGetData:
-			req.resNodes <- nodes
-			<-req.done
+	if hooks != nil {
+		g.Go(func() error { return hooks.run(ctx) })
+	}
 
-		case <-p.terminate:
-			break outer
+	if useUI {
+		u, err := newUI(s, inv, cli.Columns, ctxCancel)
+		if err != nil {
+			s.Close()
+			return err
 		}
+
+		g.Go(func() error { return u.run(ctx) })
 	}
 
-	go func() {
-		for {
-			select {
-			case _, ok := <-p.arp:
-				if !ok {
-					return
-				}
-			case <-p.dns:
-			case <-p.mdns:
-			case <-p.nbns:
-			case req := <-p.uiGetData:
-				req.resNodes <- nil
+	g.Go(func() error {
+		err := s.Run(ctx)
+
+		// the terminal interface remains open in order to show results
+		if err == nil && s.Complete() && !useUI {
+			if cli.Headless {
+				fmt.Printf("%-8s %d nodes, %d sweeps\n", "done", s.Stats().NewNodes, s.SweepProgress().Sweeps)
 			}
+			ctxCancel()
 		}
-	}()
 
-	p.ui.close()
+		return err
+	})
 
-	/*close(p.arp)
-	close(p.dns)
-	close(p.mdns)
-	close(p.nbns)
-	close(p.uiGetData)*/
+	err = g.Wait()
+	if err != nil {
+		return err
+	}
+
+	if cli.Headless && unknownFound.Load() {
+		return fmt.Errorf("unknown devices found")
+	}
+
+	return nil
 }
 
 func main() {
-	err := newProgram()
+	err := run()
 	if err != nil {
 		fmt.Println("ERR:", err)
 		os.Exit(1)
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var metricsMethods = []string{"arp", "mdns", "nbns", "dns", "dhcp"}
+
+var metricsLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsWriter writes metrics in the Prometheus text exposition format.
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (mw metricsWriter) header(name string, typ string, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (mw metricsWriter) sample(name string, labels [][2]string, value interface{}) {
+	if len(labels) == 0 {
+		fmt.Fprintf(mw.w, "%s %v\n", name, value)
+		return
+	}
+
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = l[0] + `="` + metricsLabelReplacer.Replace(l[1]) + `"`
+	}
+
+	fmt.Fprintf(mw.w, "%s{%s} %v\n", name, strings.Join(parts, ","), value)
+}
+
+func writeMetrics(w io.Writer, s apiScanner) {
+	nodes := s.Nodes()
+	st := s.Stats()
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return bytes.Compare(nodes[i].IP, nodes[j].IP) < 0
+	})
+
+	online := 0
+	for _, n := range nodes {
+		if n.Online {
+			online++
+		}
+	}
+
+	mw := metricsWriter{w}
+
+	mw.header("landiscover_nodes", "gauge", "Number of known nodes.")
+	mw.sample("landiscover_nodes", nil, len(nodes))
+
+	mw.header("landiscover_nodes_online", "gauge", "Number of nodes seen recently.")
+	mw.sample("landiscover_nodes_online", nil, online)
+
+	mw.header("landiscover_nodes_new_total", "counter", "Number of nodes found.")
+	mw.sample("landiscover_nodes_new_total", nil, st.NewNodes)
+
+	dhcpServers := s.DHCPServers()
+	rogue := 0
+	for _, srv := range dhcpServers {
+		if !srv.Allowed {
+			rogue++
+		}
+	}
+
+	mw.header("landiscover_dhcp_servers", "gauge", "Number of DHCP servers found.")
+	mw.sample("landiscover_dhcp_servers", nil, len(dhcpServers))
+
+	mw.header("landiscover_dhcp_servers_rogue", "gauge", "Number of DHCP servers not in the allowlist.")
+	mw.sample("landiscover_dhcp_servers_rogue", nil, rogue)
+
+	mw.header("landiscover_alerts_total", "counter", "Number of alerts raised.")
+	mw.sample("landiscover_alerts_total", nil, st.Alerts)
+
+	mw.header("landiscover_probes_sent_total", "counter", "Number of requests sent.")
+	for _, m := range metricsMethods {
+		mw.sample("landiscover_probes_sent_total", [][2]string{{"method", m}}, st.Methods[m].ProbesSent)
+	}
+
+	mw.header("landiscover_responses_total", "counter", "Number of valid responses received.")
+	for _, m := range metricsMethods {
+		mw.sample("landiscover_responses_total", [][2]string{{"method", m}}, st.Methods[m].Responses)
+	}
+
+	mw.header("landiscover_parse_errors_total", "counter", "Number of frames that could not be decoded.")
+	for _, m := range metricsMethods {
+		// DNS is resolved by the system
+		if m == "dns" {
+			continue
+		}
+		mw.sample("landiscover_parse_errors_total", [][2]string{{"layer", m}}, st.Methods[m].ParseErrors)
+	}
+
+	mw.header("landiscover_listener_frames_total", "counter", "Number of frames read from the interface.")
+	mw.sample("landiscover_listener_frames_total", nil, st.FramesReceived)
+
+	mw.header("landiscover_listener_drops_total", "counter", "Number of frames dropped by the kernel.")
+	mw.sample("landiscover_listener_drops_total", nil, st.ListenerDrops)
+
+	mw.header("landiscover_node_last_seen_timestamp_seconds", "gauge", "Time when the node was last seen.")
+	for _, n := range nodes {
+		mw.sample("landiscover_node_last_seen_timestamp_seconds", [][2]string{
+			{"mac", n.MAC.String()},
+			{"ip", n.IP.String()},
+			{"interface", n.Interface},
+			{"name", hostname(n)},
+		}, float64(n.LastSeen.UnixNano())/1e9)
+	}
+}
+
+func (a *apiServer) onMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, a.s)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes()) //nolint:errcheck
+}
@@ -0,0 +1,67 @@
+package discover
+
+import (
+	"net"
+	"time"
+)
+
+const maxAlerts = 100
+
+// AlertKind is the kind of an Alert.
+type AlertKind int
+
+// alert kinds.
+const (
+	// AlertIPConflict is raised when an IP is claimed by multiple MAC addresses.
+	AlertIPConflict AlertKind = iota
+
+	// AlertGatewayMACChange is raised when the MAC address of the gateway changes.
+	AlertGatewayMACChange
+
+	// AlertMACManyIPs is raised when a MAC address claims many IPs in a short time.
+	AlertMACManyIPs
+
+	// AlertGratuitousFlap is raised when gratuitous ARPs for an IP
+	// keep switching between MAC addresses.
+	AlertGratuitousFlap
+
+	// AlertRogueDHCP is raised when a DHCP server that is not in
+	// Options.AllowedDHCPServers is found.
+	AlertRogueDHCP
+)
+
+// String implements fmt.Stringer.
+func (k AlertKind) String() string {
+	switch k {
+	case AlertIPConflict:
+		return "ipconflict"
+	case AlertGatewayMACChange:
+		return "gatewaychange"
+	case AlertMACManyIPs:
+		return "macmanyips"
+	case AlertGratuitousFlap:
+		return "garpflap"
+	case AlertRogueDHCP:
+		return "roguedhcp"
+	}
+	return "unknown"
+}
+
+// Alert is a suspicious condition detected in the local network.
+type Alert struct {
+	Time    time.Time
+	Kind    AlertKind
+	Message string
+
+	// IP is the contended IP, if any.
+	IP net.IP
+
+	// MACs are the MAC addresses involved.
+	MACs []net.HardwareAddr
+
+	// Interface is the name of the interface the alert was raised on.
+	Interface string
+
+	// VLAN is the VLAN ID of the frames that raised the alert, or zero if they are not tagged.
+	VLAN uint16
+}
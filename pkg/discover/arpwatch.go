@@ -0,0 +1,224 @@
+package discover
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// an IP claimed by two MACs within this window is a conflict.
+	arpConflictWindow = 5 * time.Minute
+
+	// a MAC that claims more than macIPsThreshold IPs within macIPsWindow is suspicious.
+	macIPsWindow    = 10 * time.Second
+	macIPsThreshold = 8
+
+	// an IP whose gratuitous ARPs change MAC more than flapThreshold times
+	// within flapWindow is flapping.
+	flapWindow    = 1 * time.Minute
+	flapThreshold = 3
+
+	// an alert is not repeated for the same subject within this period.
+	alertCooldown = 1 * time.Minute
+
+	// entries that are out of their window are removed with this period.
+	arpPrunePeriod = 1 * time.Minute
+)
+
+type ipClaim struct {
+	mac  [6]byte
+	time time.Time
+}
+
+type macClaim struct {
+	ip   [4]byte
+	time time.Time
+}
+
+// arpWatch detects ARP spoofing and IP conflicts.
+// It is used by the runNodes goroutine only and doesn't need locking.
+type arpWatch struct {
+	gatewayIP  net.IP
+	gatewayMac net.HardwareAddr
+
+	// last claim of each IP by each MAC
+	ipClaims map[[4]byte][]ipClaim
+
+	// recent IPs claimed by each MAC
+	macClaims map[[6]byte][]macClaim
+
+	// recent MAC changes in gratuitous ARPs of each IP
+	flaps map[[4]byte][]time.Time
+
+	// last gratuitous ARP MAC of each IP
+	lastGratuitous map[[4]byte][6]byte
+
+	lastAlert map[string]time.Time
+
+	lastPrune time.Time
+}
+
+func newARPWatch(gatewayIP net.IP) *arpWatch {
+	return &arpWatch{
+		gatewayIP:      gatewayIP.To4(),
+		ipClaims:       make(map[[4]byte][]ipClaim),
+		macClaims:      make(map[[6]byte][]macClaim),
+		flaps:          make(map[[4]byte][]time.Time),
+		lastGratuitous: make(map[[4]byte][6]byte),
+		lastAlert:      make(map[string]time.Time),
+	}
+}
+
+// prune removes claims, flaps and alerts that are out of their window,
+// in order not to grow with every IP and MAC ever seen.
+func (w *arpWatch) prune(now time.Time) {
+	for ip, claims := range w.ipClaims {
+		if !slices.ContainsFunc(claims, func(c ipClaim) bool { return now.Sub(c.time) < arpConflictWindow }) {
+			delete(w.ipClaims, ip)
+		}
+	}
+
+	for mac, claims := range w.macClaims {
+		if !slices.ContainsFunc(claims, func(c macClaim) bool { return now.Sub(c.time) < macIPsWindow }) {
+			delete(w.macClaims, mac)
+		}
+	}
+
+	for ip, flaps := range w.flaps {
+		if !slices.ContainsFunc(flaps, func(t time.Time) bool { return now.Sub(t) < flapWindow }) {
+			delete(w.flaps, ip)
+		}
+	}
+
+	for subject, t := range w.lastAlert {
+		if now.Sub(t) >= alertCooldown {
+			delete(w.lastAlert, subject)
+		}
+	}
+}
+
+// observe processes an ARP sender MAC/IP pair and returns the resulting alerts.
+func (w *arpWatch) observe(req arpReq, now time.Time) []Alert {
+	var ret []Alert
+
+	if now.Sub(w.lastPrune) >= arpPrunePeriod {
+		w.prune(now)
+		w.lastPrune = now
+	}
+
+	key := newNodeKey(req.srcMac, req.srcIP)
+
+	alert := func(subject string, a Alert) {
+		if t, ok := w.lastAlert[subject]; ok && now.Sub(t) < alertCooldown {
+			return
+		}
+		w.lastAlert[subject] = now
+		a.Time = now
+		ret = append(ret, a)
+	}
+
+	// gateway MAC change
+	isGateway := w.gatewayIP != nil && w.gatewayIP.Equal(req.srcIP)
+	if isGateway {
+		if w.gatewayMac != nil && !bytes.Equal(w.gatewayMac, req.srcMac) {
+			alert("gateway_"+req.srcMac.String(), Alert{
+				Kind: AlertGatewayMACChange,
+				Message: fmt.Sprintf("gateway %s changed MAC from %s to %s",
+					req.srcIP, w.gatewayMac, req.srcMac),
+				IP:   req.srcIP,
+				MACs: []net.HardwareAddr{w.gatewayMac, req.srcMac},
+			})
+		}
+		w.gatewayMac = req.srcMac
+	}
+
+	// IP claimed by multiple MACs
+	claims := w.ipClaims[key.ip][:0]
+	var others []net.HardwareAddr
+	found := false
+	for _, c := range w.ipClaims[key.ip] {
+		if now.Sub(c.time) >= arpConflictWindow {
+			continue
+		}
+		if c.mac == key.mac {
+			found = true
+			c.time = now
+		} else {
+			others = append(others, copyMac(c.mac[:]))
+		}
+		claims = append(claims, c)
+	}
+	if !found {
+		claims = append(claims, ipClaim{mac: key.mac, time: now})
+	}
+	w.ipClaims[key.ip] = claims
+
+	if len(others) != 0 && !isGateway {
+		alert("conflict_"+req.srcIP.String(), Alert{
+			Kind: AlertIPConflict,
+			Message: fmt.Sprintf("%s is claimed by %s and %s",
+				req.srcIP, req.srcMac, joinMacs(others)),
+			IP:   req.srcIP,
+			MACs: append([]net.HardwareAddr{req.srcMac}, others...),
+		})
+	}
+
+	// MAC claiming many IPs
+	mclaims := w.macClaims[key.mac][:0]
+	distinct := map[[4]byte]struct{}{key.ip: {}}
+	for _, c := range w.macClaims[key.mac] {
+		if now.Sub(c.time) < macIPsWindow && c.ip != key.ip {
+			mclaims = append(mclaims, c)
+			distinct[c.ip] = struct{}{}
+		}
+	}
+	w.macClaims[key.mac] = append(mclaims, macClaim{ip: key.ip, time: now})
+
+	if len(distinct) > macIPsThreshold {
+		alert("manyips_"+req.srcMac.String(), Alert{
+			Kind: AlertMACManyIPs,
+			Message: fmt.Sprintf("%s claimed %d IPs in %v",
+				req.srcMac, len(distinct), macIPsWindow),
+			MACs: []net.HardwareAddr{req.srcMac},
+		})
+	}
+
+	// gratuitous ARP flapping
+	if req.gratuitous {
+		if prev, ok := w.lastGratuitous[key.ip]; ok && prev != key.mac {
+			flaps := w.flaps[key.ip][:0]
+			for _, t := range w.flaps[key.ip] {
+				if now.Sub(t) < flapWindow {
+					flaps = append(flaps, t)
+				}
+			}
+			flaps = append(flaps, now)
+			w.flaps[key.ip] = flaps
+
+			if len(flaps) >= flapThreshold {
+				alert("flap_"+req.srcIP.String(), Alert{
+					Kind: AlertGratuitousFlap,
+					Message: fmt.Sprintf("gratuitous ARPs for %s switched MAC %d times in %v",
+						req.srcIP, len(flaps), flapWindow),
+					IP:   req.srcIP,
+					MACs: []net.HardwareAddr{copyMac(prev[:]), req.srcMac},
+				})
+			}
+		}
+		w.lastGratuitous[key.ip] = key.mac
+	}
+
+	return ret
+}
+
+func joinMacs(macs []net.HardwareAddr) string {
+	strs := make([]string, len(macs))
+	for i, m := range macs {
+		strs[i] = m.String()
+	}
+	return strings.Join(strs, ", ")
+}
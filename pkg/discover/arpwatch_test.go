@@ -0,0 +1,58 @@
+package discover
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestARPWatchPrune(t *testing.T) {
+	w := newARPWatch(nil)
+	start := time.Now()
+
+	req := func(mac string, ip string, gratuitous bool) arpReq {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return arpReq{srcMac: hw, srcIP: net.ParseIP(ip).To4(), gratuitous: gratuitous}
+	}
+
+	// a conflict and a gratuitous ARP flap fill every map
+	w.observe(req("00:11:22:33:44:01", "192.168.1.10", true), start)
+	alerts := w.observe(req("00:11:22:33:44:02", "192.168.1.10", true), start)
+	if len(alerts) != 1 || alerts[0].Kind != AlertIPConflict {
+		t.Fatalf("unexpected alerts: %v", alerts)
+	}
+
+	sizes := func() [4]int {
+		return [4]int{len(w.ipClaims), len(w.macClaims), len(w.flaps), len(w.lastAlert)}
+	}
+	if sizes() != [4]int{1, 2, 1, 1} {
+		t.Fatalf("unexpected sizes: %v", sizes())
+	}
+
+	// claims of MACs and alerts are removed after their window
+	w.observe(req("00:11:22:33:44:03", "192.168.1.20", false), start.Add(arpPrunePeriod))
+	if sizes() != [4]int{2, 1, 0, 0} {
+		t.Fatalf("unexpected sizes: %v", sizes())
+	}
+
+	// the alert can be raised again
+	alerts = w.observe(req("00:11:22:33:44:01", "192.168.1.10", false), start.Add(arpPrunePeriod))
+	if len(alerts) != 1 || alerts[0].Kind != AlertIPConflict {
+		t.Fatalf("unexpected alerts: %v", alerts)
+	}
+
+	// claims of IPs are kept during the conflict window
+	w.observe(req("00:11:22:33:44:04", "192.168.1.30", false), start.Add(arpPrunePeriod+arpConflictWindow-time.Second))
+	if sizes() != [4]int{3, 1, 0, 0} {
+		t.Fatalf("unexpected sizes: %v", sizes())
+	}
+
+	// and removed after it
+	w.observe(req("00:11:22:33:44:04", "192.168.1.30", false), start.Add(2*arpPrunePeriod+arpConflictWindow))
+	if sizes() != [4]int{1, 1, 0, 0} {
+		t.Fatalf("unexpected sizes: %v", sizes())
+	}
+}
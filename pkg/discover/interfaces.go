@@ -0,0 +1,171 @@
+package discover
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+)
+
+// InterfaceInfo describes an interface the scanner is bound to.
+type InterfaceInfo struct {
+	Name  string
+	OwnIP net.IP
+
+	// Gateway is the IP of the gateway of the interface, or nil if it is unknown.
+	Gateway net.IP
+}
+
+// boundSocket is a raw socket bound to an interface.
+type boundSocket struct {
+	intf    *net.Interface
+	ownIP   net.IP
+	gateway net.IP
+	socket  packetConn
+}
+
+// scanIntf is an interface the scanner is bound to, with its listener and methods.
+type scanIntf struct {
+	index     int
+	intf      *net.Interface
+	ownIP     net.IP
+	gatewayIP net.IP
+	ranges    []*net.IPNet
+	targets   []vlanTarget
+	watches   map[uint16]*arpWatch
+	ls        *listener
+	ma        *methodArp
+	mm        *methodMdns
+	mn        *methodNbns
+	md        *methodDhcp
+	pg        *pinger
+}
+
+func (si *scanIntf) subnet() *net.IPNet {
+	return &net.IPNet{
+		IP:   si.ownIP.Mask(net.CIDRMask(24, 32)),
+		Mask: net.CIDRMask(24, 32),
+	}
+}
+
+func (si *scanIntf) nodeKey(vlan uint16, mac []byte, ip []byte) nodeKey {
+	key := newNodeKey(mac, ip)
+	key.intf = si.index
+	key.vlan = vlan
+	return key
+}
+
+// srcIP returns the source IP of requests sent on a VLAN.
+// The scanner has no address on tagged VLANs.
+func (si *scanIntf) srcIP(vlan uint16) net.IP {
+	if vlan != 0 {
+		return net.IP{0, 0, 0, 0}
+	}
+	return si.ownIP
+}
+
+// watch returns the ARP monitor of a VLAN.
+// The gateway is monitored on the untagged network only.
+// It is used by the runNodes goroutine only.
+func (si *scanIntf) watch(vlan uint16) *arpWatch {
+	w, ok := si.watches[vlan]
+	if !ok {
+		if vlan == 0 {
+			w = newARPWatch(si.gatewayIP)
+		} else {
+			w = newARPWatch(nil)
+		}
+		si.watches[vlan] = w
+	}
+	return w
+}
+
+func rangesOverlap(a *net.IPNet, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// interfaceOwnIP returns the IPv4 address of an interface.
+func interfaceOwnIP(intf *net.Interface) (net.IP, error) {
+	addrs, err := intf.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range addrs {
+		if ipn, ok := a.(*net.IPNet); ok {
+			if ip4 := ipn.IP.To4(); ip4 != nil {
+				if bytes.Equal(ipn.Mask, []byte{255, 255, 255, 0}) {
+					return ip4, nil
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%s: no valid ip found", intf.Name)
+}
+
+// allInterfaceNames returns the names of the interfaces that can be scanned.
+func allInterfaceNames() ([]string, error) {
+	intfs, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+
+	for _, in := range intfs {
+		if (in.Flags&net.FlagLoopback) != 0 ||
+			(in.Flags&net.FlagBroadcast) == 0 ||
+			(in.Flags&net.FlagUp) == 0 {
+			continue
+		}
+
+		in := in
+		if _, err := interfaceOwnIP(&in); err != nil {
+			continue
+		}
+
+		ret = append(ret, in.Name)
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no interfaces found")
+	}
+
+	return ret, nil
+}
+
+// bindInterface opens a raw socket on an interface.
+func bindInterface(intfName string, gateway net.IP, single bool) (boundSocket, error) {
+	intf, err := net.InterfaceByName(intfName)
+	if err != nil {
+		return boundSocket{}, fmt.Errorf("invalid interface: %s", intfName)
+	}
+
+	if (intf.Flags & net.FlagBroadcast) == 0 {
+		return boundSocket{}, fmt.Errorf("interface %s does not support broadcast", intfName)
+	}
+
+	ownIP, err := interfaceOwnIP(intf)
+	if err != nil {
+		return boundSocket{}, err
+	}
+
+	// the provided gateway is used by the interface on the same subnet
+	subnet := &net.IPNet{IP: ownIP.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+	if gateway == nil || (!single && !subnet.Contains(gateway)) {
+		// a missing gateway is not an error
+		gateway, _ = defaultGateway(intf.Name)
+	}
+
+	socket, err := newRawSocket(intf)
+	if err != nil {
+		return boundSocket{}, err
+	}
+
+	return boundSocket{
+		intf:    intf,
+		ownIP:   ownIP,
+		gateway: gateway,
+		socket:  socket,
+	}, nil
+}
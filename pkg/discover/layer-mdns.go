@@ -1,4 +1,4 @@
-package main
+package discover
 
 import (
 	"encoding/binary"
@@ -13,26 +13,35 @@ const mdnsPort = 5353
 
 var reMdnsQueryLocal = regexp.MustCompile(`^([0-9]{1,3})\.([0-9]{1,3})\.([0-9]{1,3})\.([0-9]{1,3})\.in-addr\.arpa$`)
 
-var layerTypeMdns gopacket.LayerType
+var reMdnsService = regexp.MustCompile(`(?:^|\.)(_[^.]+\._(?:tcp|udp))\.local$`)
 
-type layerMdns struct {
+// query that enumerates the service types of a network (RFC 6763, section 9)
+const mdnsServicesQuery = "_services._dns-sd._udp.local"
+
+// LayerTypeMdns is the layer type of LayerMdns.
+var LayerTypeMdns = registerLayerMdns()
+
+// LayerMdns is a mDNS layer.
+type LayerMdns struct {
 	layers.BaseLayer
 	TransactionID   uint16
 	IsResponse      bool
 	Opcode          uint8
-	Questions       []mdnsQuestion
-	Answers         []mdnsAnswer
+	Questions       []MdnsQuestion
+	Answers         []MdnsAnswer
 	AuthorityCount  uint16
 	AdditionalCount uint16
 }
 
-type mdnsQuestion struct {
+// MdnsQuestion is a question of a LayerMdns.
+type MdnsQuestion struct {
 	Query string
 	Type  uint16
 	Class uint16
 }
 
-type mdnsAnswer struct {
+// MdnsAnswer is an answer of a LayerMdns.
+type MdnsAnswer struct {
 	Query      string
 	Type       uint16
 	Class      uint16
@@ -40,19 +49,20 @@ type mdnsAnswer struct {
 	DomainName string
 }
 
-func layerMdnsInit() {
-	layerTypeMdns = gopacket.RegisterLayerType(
+func registerLayerMdns() gopacket.LayerType {
+	t := gopacket.RegisterLayerType(
 		2501,
 		gopacket.LayerTypeMetadata{
 			Name:    "Mdns",
 			Decoder: gopacket.DecodeFunc(layerMdnsDecode),
 		},
 	)
-	layers.RegisterUDPPortLayerType(mdnsPort, layerTypeMdns)
+	layers.RegisterUDPPortLayerType(mdnsPort, t)
+	return t
 }
 
 func layerMdnsDecode(data []byte, p gopacket.PacketBuilder) error {
-	l := &layerMdns{}
+	l := &LayerMdns{}
 	err := l.DecodeFromBytes(data, p)
 	if err != nil {
 		return err
@@ -62,25 +72,34 @@ func layerMdnsDecode(data []byte, p gopacket.PacketBuilder) error {
 	return nil
 }
 
-func (l *layerMdns) LayerType() gopacket.LayerType {
-	return layerTypeMdns
+// LayerType implements gopacket.Layer.
+func (l *LayerMdns) LayerType() gopacket.LayerType {
+	return LayerTypeMdns
 }
 
-func (l *layerMdns) CanDecode() gopacket.LayerClass {
-	return layerTypeMdns
+// CanDecode implements gopacket.DecodingLayer.
+func (l *LayerMdns) CanDecode() gopacket.LayerClass {
+	return LayerTypeMdns
 }
 
-func (l *layerMdns) NextLayerType() gopacket.LayerType {
+// NextLayerType implements gopacket.DecodingLayer.
+func (l *LayerMdns) NextLayerType() gopacket.LayerType {
 	return gopacket.LayerTypeZero
 }
 
-func (l *layerMdns) Payload() []byte {
+// Payload implements gopacket.Layer.
+func (l *LayerMdns) Payload() []byte {
 	return nil
 }
 
-func (l *layerMdns) DecodeFromBytes(data []byte, _ gopacket.DecodeFeedback) error {
+// DecodeFromBytes implements gopacket.DecodingLayer.
+func (l *LayerMdns) DecodeFromBytes(data []byte, _ gopacket.DecodeFeedback) error {
 	l.BaseLayer = layers.BaseLayer{Contents: data}
 
+	if len(data) < 12 {
+		return fmt.Errorf("invalid packet")
+	}
+
 	l.TransactionID = binary.BigEndian.Uint16(data[0:2])
 	l.IsResponse = (data[3] >> 7) == 0x01
 	l.Opcode = (data[3] >> 3) & 0x0F
@@ -90,13 +109,31 @@ func (l *layerMdns) DecodeFromBytes(data []byte, _ gopacket.DecodeFeedback) erro
 	l.AdditionalCount = binary.BigEndian.Uint16(data[10:12])
 	pos := 12
 
-	if questionCount > 0 {
-		return fmt.Errorf("is question, unsupported")
+	l.Questions = nil
+	for i := uint16(0); i < questionCount; i++ {
+		q := MdnsQuestion{}
+
+		var read int
+		q.Query, read = dnsQueryDecode(data, pos)
+		if read <= 0 {
+			return fmt.Errorf("question query: invalid string")
+		}
+		pos += read
+
+		if len(data) < pos+4 {
+			return fmt.Errorf("question: invalid length")
+		}
+
+		q.Type = binary.BigEndian.Uint16(data[pos : pos+2])
+		q.Class = binary.BigEndian.Uint16(data[pos+2 : pos+4])
+		pos += 4
+
+		l.Questions = append(l.Questions, q)
 	}
 
 	l.Answers = nil
 	for i := uint16(0); i < answerCount; i++ {
-		a := mdnsAnswer{}
+		a := MdnsAnswer{}
 
 		var read int
 		a.Query, read = dnsQueryDecode(data, pos)
@@ -129,10 +166,11 @@ func (l *layerMdns) DecodeFromBytes(data []byte, _ gopacket.DecodeFeedback) erro
 	return nil
 }
 
-func (l *layerMdns) SerializeTo(b gopacket.SerializeBuffer, _ gopacket.SerializeOptions) error {
+// SerializeTo implements gopacket.SerializableLayer.
+func (l *LayerMdns) SerializeTo(b gopacket.SerializeBuffer, _ gopacket.SerializeOptions) error {
 	data, err := b.AppendBytes(12)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	binary.BigEndian.PutUint16(data[0:2], l.TransactionID)
@@ -150,7 +188,7 @@ func (l *layerMdns) SerializeTo(b gopacket.SerializeBuffer, _ gopacket.Serialize
 
 		data, err := b.AppendBytes(len(enc) + 4)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		copy(data[:len(enc)], enc)
@@ -159,5 +197,17 @@ func (l *layerMdns) SerializeTo(b gopacket.SerializeBuffer, _ gopacket.Serialize
 		binary.BigEndian.PutUint16(data[2:4], q.Class)
 	}
 
+	for _, a := range l.Answers {
+		var rdata []byte
+		if a.Type == 12 { // PTR
+			rdata = dnsQueryEncode(a.DomainName)
+		}
+
+		err = dnsRecordEncode(b, a.Query, a.Type, a.Class, a.TTL, rdata)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -1,4 +1,4 @@
-package main
+package discover
 
 import (
 	"encoding/binary"
@@ -11,9 +11,11 @@ import (
 
 const nbnsPort = 137
 
-var layerTypeNbns gopacket.LayerType
+// LayerTypeNbns is the layer type of LayerNbns.
+var LayerTypeNbns = registerLayerNbns()
 
-type layerNbns struct {
+// LayerNbns is a NetBIOS name service layer.
+type LayerNbns struct {
 	layers.BaseLayer
 	TransactionID   uint16
 	IsResponse      bool
@@ -21,45 +23,49 @@ type layerNbns struct {
 	Truncated       bool
 	Recursion       bool
 	Broadcast       bool
-	Questions       []nbnsQuestion
-	Answers         []nbnsAnswer
+	Questions       []NbnsQuestion
+	Answers         []NbnsAnswer
 	AuthorityCount  uint16
 	AdditionalCount uint16
 }
 
-type nbnsQuestion struct {
+// NbnsQuestion is a question of a LayerNbns.
+type NbnsQuestion struct {
 	Query string
 	Type  uint16
 	Class uint16
 }
 
-type nbnsAnswer struct {
+// NbnsAnswer is an answer of a LayerNbns.
+type NbnsAnswer struct {
 	Query string
 	Type  uint16
 	Class uint16
 	TTL   uint32
-	Names []nbnsAnswerName
+	Names []NbnsAnswerName
 }
 
-type nbnsAnswerName struct {
+// NbnsAnswerName is a name contained in a NB_STAT NbnsAnswer.
+type NbnsAnswerName struct {
 	Name  string
 	Type  uint8
 	Flags uint16
 }
 
-func layerNbnsInit() {
-	layerTypeNbns = gopacket.RegisterLayerType(
+func registerLayerNbns() gopacket.LayerType {
+	t := gopacket.RegisterLayerType(
 		2500,
 		gopacket.LayerTypeMetadata{
 			Name:    "Nbns",
 			Decoder: gopacket.DecodeFunc(layerNbnsDecode),
 		},
 	)
-	layers.RegisterUDPPortLayerType(nbnsPort, layerTypeNbns)
+	layers.RegisterUDPPortLayerType(nbnsPort, t)
+	return t
 }
 
 func layerNbnsDecode(data []byte, p gopacket.PacketBuilder) error {
-	l := &layerNbns{}
+	l := &LayerNbns{}
 	err := l.DecodeFromBytes(data, p)
 	if err != nil {
 		return err
@@ -69,23 +75,28 @@ func layerNbnsDecode(data []byte, p gopacket.PacketBuilder) error {
 	return nil
 }
 
-func (l *layerNbns) LayerType() gopacket.LayerType {
-	return layerTypeNbns
+// LayerType implements gopacket.Layer.
+func (l *LayerNbns) LayerType() gopacket.LayerType {
+	return LayerTypeNbns
 }
 
-func (l *layerNbns) CanDecode() gopacket.LayerClass {
-	return layerTypeNbns
+// CanDecode implements gopacket.DecodingLayer.
+func (l *LayerNbns) CanDecode() gopacket.LayerClass {
+	return LayerTypeNbns
 }
 
-func (l *layerNbns) NextLayerType() gopacket.LayerType {
+// NextLayerType implements gopacket.DecodingLayer.
+func (l *LayerNbns) NextLayerType() gopacket.LayerType {
 	return gopacket.LayerTypeZero
 }
 
-func (l *layerNbns) Payload() []byte {
+// Payload implements gopacket.Layer.
+func (l *LayerNbns) Payload() []byte {
 	return nil
 }
 
-func (l *layerNbns) DecodeFromBytes(data []byte, _ gopacket.DecodeFeedback) error {
+// DecodeFromBytes implements gopacket.DecodingLayer.
+func (l *LayerNbns) DecodeFromBytes(data []byte, _ gopacket.DecodeFeedback) error {
 	l.BaseLayer = layers.BaseLayer{Contents: data}
 
 	if len(data) < 12 {
@@ -104,13 +115,31 @@ func (l *layerNbns) DecodeFromBytes(data []byte, _ gopacket.DecodeFeedback) erro
 	l.AdditionalCount = binary.BigEndian.Uint16(data[10:12])
 	pos := 12
 
-	if questionCount > 0 {
-		return fmt.Errorf("is question, unsupported")
+	l.Questions = nil
+	for i := uint16(0); i < questionCount; i++ {
+		q := NbnsQuestion{}
+
+		var read int
+		q.Query, read = dnsQueryDecode(data, pos)
+		if read <= 0 {
+			return fmt.Errorf("question query: invalid string")
+		}
+		pos += read
+
+		if len(data) < pos+4 {
+			return fmt.Errorf("question: invalid length")
+		}
+
+		q.Type = binary.BigEndian.Uint16(data[pos : pos+2])
+		q.Class = binary.BigEndian.Uint16(data[pos+2 : pos+4])
+		pos += 4
+
+		l.Questions = append(l.Questions, q)
 	}
 
 	l.Answers = nil
 	for i := uint16(0); i < answerCount; i++ {
-		a := nbnsAnswer{}
+		a := NbnsAnswer{}
 
 		var read int
 		a.Query, read = dnsQueryDecode(data, pos)
@@ -131,8 +160,8 @@ func (l *layerNbns) DecodeFromBytes(data []byte, _ gopacket.DecodeFeedback) erro
 			pos2++
 
 			for j := uint8(0); j < nameCount; j++ {
-				a.Names = append(a.Names, nbnsAnswerName{
-					Name:  strings.TrimSuffix(string(data[pos2:pos2+15]), " "),
+				a.Names = append(a.Names, NbnsAnswerName{
+					Name:  strings.TrimRight(string(data[pos2:pos2+15]), " "),
 					Type:  data[pos2+15],
 					Flags: binary.BigEndian.Uint16(data[pos2+16 : pos2+18]),
 				})
@@ -147,10 +176,11 @@ func (l *layerNbns) DecodeFromBytes(data []byte, _ gopacket.DecodeFeedback) erro
 	return nil
 }
 
-func (l *layerNbns) SerializeTo(b gopacket.SerializeBuffer, _ gopacket.SerializeOptions) error {
+// SerializeTo implements gopacket.SerializableLayer.
+func (l *LayerNbns) SerializeTo(b gopacket.SerializeBuffer, _ gopacket.SerializeOptions) error {
 	data, err := b.AppendBytes(12)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	binary.BigEndian.PutUint16(data[0:2], l.TransactionID)
@@ -177,7 +207,7 @@ func (l *layerNbns) SerializeTo(b gopacket.SerializeBuffer, _ gopacket.Serialize
 
 		data, err := b.AppendBytes(len(enc) + 4)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		copy(data[:len(enc)], enc)
@@ -186,5 +216,26 @@ func (l *layerNbns) SerializeTo(b gopacket.SerializeBuffer, _ gopacket.Serialize
 		binary.BigEndian.PutUint16(data[2:4], q.Class)
 	}
 
+	for _, a := range l.Answers {
+		var rdata []byte
+		if a.Type == 0x21 { // NB_STAT
+			rdata = make([]byte, 1+18*len(a.Names))
+			rdata[0] = uint8(len(a.Names))
+			pos := 1
+
+			for _, n := range a.Names {
+				copy(rdata[pos:pos+15], fmt.Sprintf("%-15s", n.Name))
+				rdata[pos+15] = n.Type
+				binary.BigEndian.PutUint16(rdata[pos+16:pos+18], n.Flags)
+				pos += 18
+			}
+		}
+
+		err = dnsRecordEncode(b, a.Query, a.Type, a.Class, a.TTL, rdata)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,65 @@
+package discover
+
+import (
+	"context"
+)
+
+type listener struct {
+	s      *Scanner
+	si     *scanIntf
+	socket packetConn
+
+	listenDone chan struct{}
+}
+
+func newListener(s *Scanner, si *scanIntf, socket packetConn) error {
+	ls := &listener{
+		s:          s,
+		si:         si,
+		socket:     socket,
+		listenDone: make(chan struct{}),
+	}
+
+	si.ls = ls
+	return nil
+}
+
+func (ls *listener) run(ctx context.Context) error {
+	listeners := []chan []byte{
+		ls.si.ma.listen,
+		ls.si.mm.listen,
+		ls.si.mn.listen,
+		ls.si.md.listen,
+		ls.si.pg.listen,
+	}
+
+	for {
+		raw, err := ls.socket.Read()
+		if err != nil {
+			// socket has been closed in order to stop the listener
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		ls.s.stats.framesReceived.Add(1)
+
+		for _, l := range listeners {
+			select {
+			case l <- raw:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		// join before reading again
+		for range listeners {
+			select {
+			case <-ls.listenDone:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
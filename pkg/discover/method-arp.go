@@ -0,0 +1,332 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// pause before a retry, in order to receive late replies
+	arpRetryDelay = 1 * time.Second
+)
+
+// SweepProgress is the progress of the ARP sweep.
+type SweepProgress struct {
+	// Sent is the number of requests sent in the current pass.
+	Sent int
+
+	// Total is the number of requests of the current pass.
+	Total int
+
+	// Pass is the current pass. Passes after the first one are retries.
+	Pass int
+
+	// Sweeps is the number of completed sweeps.
+	Sweeps int
+}
+
+type methodArp struct {
+	s  *Scanner
+	si *scanIntf
+
+	listen  chan []byte
+	scanNow chan struct{}
+
+	progressMutex sync.Mutex
+	progress      SweepProgress
+}
+
+func newMethodArp(s *Scanner, si *scanIntf) error {
+	ma := &methodArp{
+		s:       s,
+		si:      si,
+		listen:  make(chan []byte),
+		scanNow: make(chan struct{}, 1),
+	}
+
+	si.ma = ma
+	return nil
+}
+
+func (ma *methodArp) runListener(ctx context.Context) error {
+	var decodedLayers []gopacket.LayerType
+	var eth layers.Ethernet
+	var dot1q layers.Dot1Q
+	var arp layers.ARP
+	var padding gopacket.Payload
+
+	parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet,
+		&eth,
+		&dot1q,
+		&arp,
+		&padding)
+
+	parse := func(raw []byte) (arpReq, bool) {
+		if err := parser.DecodeLayers(raw, &decodedLayers); err != nil {
+			if isLayerDecodeError(err, decodedLayers, layers.LayerTypeEthernet) ||
+				isLayerDecodeError(err, decodedLayers, layers.LayerTypeDot1Q) {
+				ma.s.stats.arp.parseErrors.Add(1)
+			}
+			return arpReq{}, false
+		}
+
+		if arp.Protocol != layers.EthernetTypeIPv4 ||
+			arp.HwAddressSize != 6 ||
+			arp.ProtAddressSize != 4 {
+			return arpReq{}, false
+		}
+
+		if bytes.Equal(arp.SourceProtAddress, []byte{0, 0, 0, 0}) {
+			return arpReq{}, false
+		}
+
+		srcMac := copyMac(arp.SourceHwAddress)
+		srcIP := copyIP(arp.SourceProtAddress)
+
+		// ethernet mac and arp mac must correspond
+		if !bytes.Equal(arp.SourceHwAddress, eth.SrcMAC) {
+			return arpReq{}, false
+		}
+
+		return arpReq{
+			si:     ma.si,
+			vlan:   frameVLAN(decodedLayers, &dot1q),
+			srcMac: srcMac,
+			srcIP:  srcIP,
+			// a gratuitous ARP announces the sender IP
+			gratuitous: bytes.Equal(arp.SourceProtAddress, arp.DstProtAddress),
+		}, true
+	}
+
+	for {
+		select {
+		case raw := <-ma.listen:
+			req, ok := parse(raw)
+
+			select {
+			case ma.si.ls.listenDone <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+
+			if ok {
+				ma.s.stats.arp.responses.Add(1)
+
+				select {
+				case ma.s.arp <- req:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (ma *methodArp) setProgress(cb func(p *SweepProgress)) {
+	ma.progressMutex.Lock()
+	defer ma.progressMutex.Unlock()
+	cb(&ma.progress)
+}
+
+func (ma *methodArp) getProgress() SweepProgress {
+	ma.progressMutex.Lock()
+	defer ma.progressMutex.Unlock()
+	return ma.progress
+}
+
+func (ma *methodArp) runPeriodicRequests(ctx context.Context) error {
+	for {
+		err := ma.sweep(ctx)
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+
+		if ma.s.once {
+			return nil
+		}
+
+		t := time.NewTimer(ma.s.scanInterval)
+		select {
+		case <-t.C:
+		case <-ma.scanNow:
+			t.Stop()
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		}
+	}
+}
+
+// arpDest is an IP swept by ARP.
+type arpDest struct {
+	target *vlanTarget
+	ip     net.IP
+}
+
+// sweep sends a request to every IP of the ranges of every VLAN,
+// then sends it again to IPs that did not reply, for the given number of retries.
+func (ma *methodArp) sweep(ctx context.Context) error {
+	arp := layers.ARP{
+		AddrType:        layers.LinkTypeEthernet,
+		Protocol:        layers.EthernetTypeIPv4,
+		HwAddressSize:   6,
+		ProtAddressSize: 4,
+		Operation:       layers.ARPRequest,
+		SourceHwAddress: ma.si.intf.HardwareAddr,
+		DstHwAddress:    []byte{0, 0, 0, 0, 0, 0},
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+
+	var dests []arpDest
+
+	for i := range ma.si.targets {
+		t := &ma.si.targets[i]
+
+		ips, err := randAvailableIPs(t.ranges, ma.si.ownIP)
+		if err != nil {
+			return err
+		}
+
+		for _, ip := range ips {
+			dests = append(dests, arpDest{target: t, ip: ip})
+		}
+	}
+
+	err := randShuffle(len(dests), func(i, j int) {
+		dests[i], dests[j] = dests[j], dests[i]
+	})
+	if err != nil {
+		return err
+	}
+
+	for pass := 0; pass <= ma.s.retries; pass++ {
+		if pass != 0 {
+			if !sleep(ctx, arpRetryDelay) {
+				return nil
+			}
+
+			dests = ma.unanswered(dests)
+			if len(dests) == 0 {
+				break
+			}
+		}
+
+		ma.setProgress(func(p *SweepProgress) {
+			p.Sent = 0
+			p.Total = len(dests)
+			p.Pass = pass
+		})
+
+		for _, dest := range dests {
+			if !ma.s.waitRate(ctx, "arp") {
+				return nil
+			}
+
+			arp.SourceProtAddress = ma.si.srcIP(dest.target.vlan)
+			arp.DstProtAddress = dest.ip
+
+			ls := linkLayers(ma.si.intf.HardwareAddr,
+				net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+				layers.EthernetTypeARP, dest.target.vlan)
+
+			err := gopacket.SerializeLayers(buf, opts, append(ls, &arp)...)
+			if err != nil {
+				return err
+			}
+
+			err = ma.si.ls.socket.Write(buf.Bytes())
+			if err != nil {
+				return err
+			}
+			ma.s.stats.arp.probesSent.Add(1)
+
+			ma.setProgress(func(p *SweepProgress) {
+				p.Sent++
+			})
+		}
+	}
+
+	ma.setProgress(func(p *SweepProgress) {
+		p.Sweeps++
+	})
+
+	return nil
+}
+
+// request sends an ARP request to a single node, addressed to its MAC address.
+// It is not subject to rate limits, since it is sent on demand.
+func (ma *methodArp) request(vlan uint16, destMac net.HardwareAddr, destIP net.IP) error {
+	arp := layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   ma.si.intf.HardwareAddr,
+		SourceProtAddress: ma.si.srcIP(vlan),
+		DstHwAddress:      []byte{0, 0, 0, 0, 0, 0},
+		DstProtAddress:    destIP.To4(),
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+
+	ls := linkLayers(ma.si.intf.HardwareAddr, destMac, layers.EthernetTypeARP, vlan)
+
+	err := gopacket.SerializeLayers(buf, opts, append(ls, &arp)...)
+	if err != nil {
+		return err
+	}
+
+	err = ma.si.ls.socket.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	ma.s.stats.arp.probesSent.Add(1)
+	return nil
+}
+
+// unanswered returns the destinations that are not in the node table
+// of the interface and VLAN.
+func (ma *methodArp) unanswered(dests []arpDest) []arpDest {
+	found := make(map[nodeKey]struct{})
+	for _, n := range ma.s.Nodes() {
+		if n.Interface == ma.si.intf.Name {
+			found[ma.si.nodeKey(n.VLAN, nil, n.IP.To4())] = struct{}{}
+		}
+	}
+
+	var ret []arpDest
+	for _, dest := range dests {
+		if _, ok := found[ma.si.nodeKey(dest.target.vlan, nil, dest.ip)]; !ok {
+			ret = append(ret, dest)
+		}
+	}
+	return ret
+}
+
+// triggerScan starts a sweep as soon as the current one is complete.
+func (ma *methodArp) triggerScan() {
+	select {
+	case ma.scanNow <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,288 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	dhcpServerPort  = 67
+	dhcpClientPort  = 68
+	dhcpProbePeriod = 5 * time.Minute
+)
+
+// DHCPServer is a DHCP server found in the local network.
+type DHCPServer struct {
+	LastSeen time.Time
+	MAC      net.HardwareAddr
+
+	// IP is the server identifier, or the source IP if it is not provided.
+	IP net.IP
+
+	// Subnet is the network of the offered address.
+	Subnet *net.IPNet
+
+	// Gateway is the first offered router.
+	Gateway net.IP
+
+	// DNS are the offered name servers.
+	DNS []net.IP
+
+	// Interface is the name of the interface the server was found on.
+	Interface string
+
+	// VLAN is the VLAN ID of the replies of the server, or zero if they are not tagged.
+	VLAN uint16
+
+	// Allowed is true when the server is in Options.AllowedDHCPServers,
+	// or when the allowlist is empty.
+	Allowed bool
+}
+
+type dhcpReq struct {
+	si     *scanIntf
+	vlan   uint16
+	server DHCPServer
+}
+
+type methodDhcp struct {
+	s  *Scanner
+	si *scanIntf
+
+	listen chan []byte
+}
+
+func newMethodDhcp(s *Scanner, si *scanIntf) error {
+	md := &methodDhcp{
+		s:      s,
+		si:     si,
+		listen: make(chan []byte),
+	}
+
+	si.md = md
+	return nil
+}
+
+func dhcpOption(dhcp *layers.DHCPv4, typ layers.DHCPOpt) []byte {
+	for _, o := range dhcp.Options {
+		if o.Type == typ {
+			return o.Data
+		}
+	}
+	return nil
+}
+
+func dhcpIPs(data []byte) []net.IP {
+	var ret []net.IP
+	for len(data) >= 4 {
+		ret = append(ret, copyIP(data[:4]))
+		data = data[4:]
+	}
+	return ret
+}
+
+func (md *methodDhcp) runListener(ctx context.Context) error {
+	var decodedLayers []gopacket.LayerType
+	var eth layers.Ethernet
+	var dot1q layers.Dot1Q
+	var ip layers.IPv4
+	var udp layers.UDP
+	var dhcp layers.DHCPv4
+	var payload gopacket.Payload
+
+	parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet,
+		&eth,
+		&dot1q,
+		&ip,
+		&udp,
+		&dhcp,
+		&payload)
+
+	parse := func(raw []byte) (dhcpReq, bool) {
+		if err := parser.DecodeLayers(raw, &decodedLayers); err != nil {
+			if isLayerDecodeError(err, decodedLayers, layers.LayerTypeUDP) {
+				md.s.stats.dhcp.parseErrors.Add(1)
+			}
+			return dhcpReq{}, false
+		}
+
+		if udp.SrcPort != dhcpServerPort || udp.DstPort != dhcpClientPort ||
+			!slices.Contains(decodedLayers, layers.LayerTypeDHCPv4) ||
+			dhcp.Operation != layers.DHCPOpReply {
+			return dhcpReq{}, false
+		}
+
+		// only offers and acks contain the network configuration
+		msgType := dhcpOption(&dhcp, layers.DHCPOptMessageType)
+		if len(msgType) != 1 ||
+			(layers.DHCPMsgType(msgType[0]) != layers.DHCPMsgTypeOffer &&
+				layers.DHCPMsgType(msgType[0]) != layers.DHCPMsgTypeAck) {
+			return dhcpReq{}, false
+		}
+
+		srv := DHCPServer{
+			MAC: copyMac(eth.SrcMAC),
+			IP:  copyIP(ip.SrcIP),
+			DNS: dhcpIPs(dhcpOption(&dhcp, layers.DHCPOptDNS)),
+		}
+
+		if v := dhcpOption(&dhcp, layers.DHCPOptServerID); len(v) == 4 {
+			srv.IP = copyIP(v)
+		}
+
+		if v := dhcpOption(&dhcp, layers.DHCPOptSubnetMask); len(v) == 4 && dhcp.YourClientIP != nil {
+			mask := net.IPMask(append([]byte(nil), v...))
+			srv.Subnet = &net.IPNet{
+				IP:   dhcp.YourClientIP.To4().Mask(mask),
+				Mask: mask,
+			}
+		}
+
+		if v := dhcpIPs(dhcpOption(&dhcp, layers.DHCPOptRouter)); len(v) != 0 {
+			srv.Gateway = v[0]
+		}
+
+		return dhcpReq{si: md.si, vlan: frameVLAN(decodedLayers, &dot1q), server: srv}, true
+	}
+
+	for {
+		select {
+		case raw := <-md.listen:
+			req, ok := parse(raw)
+
+			select {
+			case md.si.ls.listenDone <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+
+			if ok {
+				md.s.stats.dhcp.responses.Add(1)
+
+				select {
+				case md.s.dhcp <- req:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// request broadcasts a DHCPDISCOVER on a VLAN. The request is never followed by a DHCPREQUEST,
+// therefore no address is leased.
+func (md *methodDhcp) request(vlan uint16) error {
+	v, err := randUint16()
+	if err != nil {
+		return err
+	}
+
+	ip := layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Id:       v,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IP{0, 0, 0, 0},
+		DstIP:    net.IP{255, 255, 255, 255},
+	}
+	udp := layers.UDP{
+		SrcPort: dhcpClientPort,
+		DstPort: dhcpServerPort,
+	}
+
+	err = udp.SetNetworkLayerForChecksum(&ip)
+	if err != nil {
+		return err
+	}
+
+	xid, err := randUint32()
+	if err != nil {
+		return err
+	}
+
+	dhcp := layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          xid,
+		Flags:        0x8000, // broadcast replies
+		ClientHWAddr: md.si.intf.HardwareAddr,
+		Options: []layers.DHCPOption{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeDiscover)}),
+			layers.NewDHCPOption(layers.DHCPOptParamsRequest, []byte{
+				byte(layers.DHCPOptSubnetMask),
+				byte(layers.DHCPOptRouter),
+				byte(layers.DHCPOptDNS),
+			}),
+		},
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+
+	ls := linkLayers(md.si.intf.HardwareAddr,
+		net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		layers.EthernetTypeIPv4, vlan)
+
+	err = gopacket.SerializeLayers(buf, opts, append(ls, &ip, &udp, &dhcp)...)
+	if err != nil {
+		return err
+	}
+
+	err = md.si.ls.socket.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	md.s.stats.dhcp.probesSent.Add(1)
+	return nil
+}
+
+func (md *methodDhcp) runPeriodicRequests(ctx context.Context) error {
+	for {
+		for _, t := range md.si.targets {
+			if !md.s.waitRate(ctx, "dhcp") {
+				return nil
+			}
+
+			err := md.request(t.vlan)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !sleep(ctx, dhcpProbePeriod) {
+			return nil
+		}
+	}
+}
+
+// dhcpAllowed checks whether a server is in the allowlist.
+func dhcpAllowed(allowed []string, srv DHCPServer) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, a := range allowed {
+		if mac, err := net.ParseMAC(a); err == nil && bytes.Equal(mac, srv.MAC) {
+			return true
+		}
+		if ip := net.ParseIP(a); ip != nil && ip.Equal(srv.IP) {
+			return true
+		}
+	}
+
+	return false
+}
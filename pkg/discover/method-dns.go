@@ -0,0 +1,36 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+func (s *Scanner) dnsRequest(ctx context.Context, key nodeKey, destIP net.IP) {
+	s.stats.dns.probesSent.Add(1)
+
+	names, err := s.lookupAddr(ctx, destIP.String())
+	if err != nil {
+		// a missing name is an answer, while other errors are retried
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return
+		}
+	}
+
+	var dns string
+	if len(names) != 0 {
+		dns = sanitizeName(strings.TrimSuffix(names[0], "."))
+	}
+
+	s.stats.dns.responses.Add(1)
+
+	select {
+	case s.dns <- dnsReq{
+		key: key,
+		dns: dns,
+	}:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,248 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type methodMdns struct {
+	s  *Scanner
+	si *scanIntf
+
+	listen chan []byte
+}
+
+func newMethodMdns(s *Scanner, si *scanIntf) error {
+	mm := &methodMdns{
+		s:      s,
+		si:     si,
+		listen: make(chan []byte),
+	}
+
+	si.mm = mm
+	return nil
+}
+
+func (mm *methodMdns) runListener(ctx context.Context) error {
+	var decodedLayers []gopacket.LayerType
+	var eth layers.Ethernet
+	var dot1q layers.Dot1Q
+	var ip layers.IPv4
+	var udp layers.UDP
+	var mdns LayerMdns
+
+	parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet,
+		&eth,
+		&dot1q,
+		&ip,
+		&udp,
+		&mdns)
+
+	parse := func(raw []byte) (mdnsReq, bool) {
+		if err := parser.DecodeLayers(raw, &decodedLayers); err != nil {
+			if isLayerDecodeError(err, decodedLayers, layers.LayerTypeUDP) {
+				mm.s.stats.mdns.parseErrors.Add(1)
+			}
+			return mdnsReq{}, false
+		}
+
+		if udp.DstPort != mdnsPort && udp.SrcPort != mdnsPort {
+			return mdnsReq{}, false
+		}
+
+		if len(mdns.Answers) == 0 {
+			return mdnsReq{}, false
+		}
+
+		srcMac := copyMac(eth.SrcMAC)
+		srcIP := copyIP(ip.SrcIP)
+
+		domainName := func() string {
+			for _, a := range mdns.Answers {
+				domainName := a.DomainName
+				if a.Type != 12 { // PTR
+					continue
+				}
+
+				m := reMdnsQueryLocal.FindStringSubmatch(a.Query)
+				if m == nil {
+					continue
+				}
+
+				// accept only if mdns ip matches with sender ip
+				mdnsIP := net.ParseIP(fmt.Sprintf("%s.%s.%s.%s", m[4], m[3], m[2], m[1])).To4()
+				if !mdnsIP.Equal(srcIP) {
+					continue
+				}
+
+				return domainName
+			}
+			return ""
+		}()
+
+		var services []string
+		if mdns.IsResponse {
+			services = mdnsServices(mdns.Answers)
+		}
+
+		if domainName == "" && services == nil {
+			return mdnsReq{}, false
+		}
+
+		domainName = sanitizeName(strings.TrimSuffix(domainName, ".local"))
+
+		return mdnsReq{
+			si:         mm.si,
+			vlan:       frameVLAN(decodedLayers, &dot1q),
+			srcMac:     srcMac,
+			srcIP:      srcIP,
+			domainName: domainName,
+			services:   services,
+		}, true
+	}
+
+	for {
+		select {
+		case raw := <-mm.listen:
+			req, ok := parse(raw)
+
+			select {
+			case mm.si.ls.listenDone <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+
+			if ok {
+				mm.s.stats.mdns.responses.Add(1)
+
+				select {
+				case mm.s.mdns <- req:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// mdnsServices returns the service types contained in the answers of a response,
+// either in DNS-SD enumerations or in the records of service instances.
+func mdnsServices(answers []MdnsAnswer) []string {
+	var ret []string
+	for _, a := range answers {
+		name := a.Query
+		if name == mdnsServicesQuery && a.Type == 12 { // PTR
+			name = a.DomainName
+		}
+
+		m := reMdnsService.FindStringSubmatch(name)
+		if m == nil || name == mdnsServicesQuery {
+			continue
+		}
+
+		ret = mergeServices(ret, []string{sanitizeName(m[1])})
+	}
+	return ret
+}
+
+// mergeServices returns the sorted union of two service lists.
+// A new slice is allocated, since the existing one may be shared with copies of the node.
+func mergeServices(a []string, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+
+	ret := append(slices.Clone(a), b...)
+	slices.Sort(ret)
+	return slices.Compact(ret)
+}
+
+func (mm *methodMdns) request(vlan uint16, destIP net.IP) error {
+	mac, _ := net.ParseMAC("01:00:5e:00:00:fb")
+
+	v, err := randUint16()
+	if err != nil {
+		return err
+	}
+
+	ip := layers.IPv4{
+		Version:  4,
+		TTL:      255,
+		Id:       v,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    mm.si.srcIP(vlan),
+		DstIP:    net.ParseIP("224.0.0.251"), // TODO: provare unicast
+	}
+	udp := layers.UDP{
+		SrcPort: mdnsPort,
+		DstPort: mdnsPort,
+	}
+
+	err = udp.SetNetworkLayerForChecksum(&ip)
+	if err != nil {
+		return err
+	}
+
+	mdns := LayerMdns{
+		TransactionID: 0,
+		Questions: []MdnsQuestion{
+			{
+				Query: fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", destIP[3], destIP[2], destIP[1], destIP[0]),
+				Type:  0x0C, // domain pointer
+				Class: 1,    // IN
+			},
+		},
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+
+	ls := linkLayers(mm.si.intf.HardwareAddr, mac, layers.EthernetTypeIPv4, vlan)
+
+	err = gopacket.SerializeLayers(buf, opts, append(ls, &ip, &udp, &mdns)...)
+	if err != nil {
+		return err
+	}
+
+	err = mm.si.ls.socket.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	mm.s.stats.mdns.probesSent.Add(1)
+	return nil
+}
+
+func (mm *methodMdns) runPeriodicRequests(ctx context.Context) error {
+	for {
+		for _, t := range mm.si.targets {
+			ips, err := randAvailableIPs(t.ranges, mm.si.ownIP)
+			if err != nil {
+				return err
+			}
+
+			for _, dstAddr := range ips {
+				if !mm.s.waitRate(ctx, "mdns") {
+					return nil
+				}
+
+				err = mm.request(t.vlan, dstAddr)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package discover
+
+import (
+	"context"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type methodNbns struct {
+	s  *Scanner
+	si *scanIntf
+
+	listen chan []byte
+}
+
+func newMethodNbns(s *Scanner, si *scanIntf) error {
+	mn := &methodNbns{
+		s:      s,
+		si:     si,
+		listen: make(chan []byte),
+	}
+
+	si.mn = mn
+	return nil
+}
+
+func (mn *methodNbns) runListener(ctx context.Context) error {
+	var decodedLayers []gopacket.LayerType
+	var eth layers.Ethernet
+	var dot1q layers.Dot1Q
+	var ip layers.IPv4
+	var udp layers.UDP
+	var nbns LayerNbns
+
+	parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet,
+		&eth,
+		&dot1q,
+		&ip,
+		&udp,
+		&nbns)
+
+	parse := func(raw []byte) (nbnsReq, bool) {
+		if err := parser.DecodeLayers(raw, &decodedLayers); err != nil {
+			if isLayerDecodeError(err, decodedLayers, layers.LayerTypeUDP) {
+				mn.s.stats.nbns.parseErrors.Add(1)
+			}
+			return nbnsReq{}, false
+		}
+
+		if udp.DstPort != nbnsPort && udp.SrcPort != nbnsPort {
+			return nbnsReq{}, false
+		}
+
+		if len(nbns.Answers) != 1 {
+			return nbnsReq{}, false
+		}
+
+		name := func() string {
+			for _, n := range nbns.Answers[0].Names {
+				if n.Type == 0x20 { // service name
+					return sanitizeName(n.Name)
+				}
+			}
+			return ""
+		}()
+		if name == "" {
+			return nbnsReq{}, false
+		}
+
+		srcMac := copyMac(eth.SrcMAC)
+		srcIP := copyIP(ip.SrcIP)
+
+		return nbnsReq{
+			si:     mn.si,
+			vlan:   frameVLAN(decodedLayers, &dot1q),
+			srcMac: srcMac,
+			srcIP:  srcIP,
+			name:   name,
+			txid:   nbns.TransactionID,
+			ttl:    ip.TTL,
+		}, true
+	}
+
+	for {
+		select {
+		case raw := <-mn.listen:
+			req, ok := parse(raw)
+
+			select {
+			case mn.si.ls.listenDone <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+
+			if ok {
+				mn.s.stats.nbns.responses.Add(1)
+
+				select {
+				case mn.s.nbns <- req:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (mn *methodNbns) request(destMac net.HardwareAddr, destIP net.IP, txid uint16) error {
+	eth := layers.Ethernet{
+		SrcMAC:       mn.si.intf.HardwareAddr,
+		DstMAC:       destMac,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+
+	v, err := randUint16()
+	if err != nil {
+		return err
+	}
+
+	ip := layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Id:       v,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    mn.si.ownIP,
+		DstIP:    destIP,
+	}
+	udp := layers.UDP{
+		SrcPort: nbnsPort,
+		DstPort: nbnsPort,
+	}
+
+	err = udp.SetNetworkLayerForChecksum(&ip)
+	if err != nil {
+		return err
+	}
+
+	nbns := LayerNbns{
+		TransactionID: txid,
+		Questions: []NbnsQuestion{
+			{
+				Query: "CKAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+				Type:  0x21, // NB_STAT
+				Class: 1,    // IN
+			},
+		},
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+
+	err = gopacket.SerializeLayers(buf, opts, &eth, &ip, &udp, &nbns)
+	if err != nil {
+		return err
+	}
+
+	err = mn.si.ls.socket.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	mn.s.stats.nbns.probesSent.Add(1)
+	return nil
+}
@@ -0,0 +1,13 @@
+package discover
+
+// packetConn is a source and sink of raw ethernet frames.
+type packetConn interface {
+	// Read returns the next frame. The returned slice is valid until the next call.
+	Read() ([]byte, error)
+
+	// Write sends a frame.
+	Write(byts []byte) error
+
+	// Close releases the underlying resources.
+	Close() error
+}
@@ -0,0 +1,64 @@
+package discover
+
+import (
+	"io"
+	"sync"
+)
+
+// fakePacketConn is an in-memory packetConn.
+// Frames passed to inject() are returned by Read(), frames passed to Write() are recorded.
+type fakePacketConn struct {
+	read   chan []byte
+	closed chan struct{}
+
+	mutex     sync.Mutex
+	written   [][]byte
+	closeOnce sync.Once
+}
+
+func newFakePacketConn() *fakePacketConn {
+	return &fakePacketConn{
+		read:   make(chan []byte),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *fakePacketConn) Read() ([]byte, error) {
+	select {
+	case byts := <-c.read:
+		return byts, nil
+	case <-c.closed:
+		return nil, io.EOF
+	}
+}
+
+func (c *fakePacketConn) Write(byts []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cp := make([]byte, len(byts))
+	copy(cp, byts)
+	c.written = append(c.written, cp)
+
+	return nil
+}
+
+func (c *fakePacketConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// inject delivers a frame to the reader.
+func (c *fakePacketConn) inject(byts []byte) {
+	c.read <- byts
+}
+
+// writtenFrames returns a copy of the frames written so far.
+func (c *fakePacketConn) writtenFrames() [][]byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([][]byte(nil), c.written...)
+}
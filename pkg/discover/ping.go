@@ -0,0 +1,170 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// pingKey identifies the replies to an ICMP echo request.
+type pingKey struct {
+	ip [4]byte
+	id uint16
+}
+
+func newPingKey(ip net.IP, id uint16) pingKey {
+	var k pingKey
+	copy(k.ip[:], ip.To4())
+	k.id = id
+	return k
+}
+
+// pinger sends ICMP echo requests to single nodes and waits for the replies.
+type pinger struct {
+	s  *Scanner
+	si *scanIntf
+
+	listen chan []byte
+
+	mutex   sync.Mutex
+	waiters map[pingKey]chan time.Time
+}
+
+func newPinger(s *Scanner, si *scanIntf) error {
+	pg := &pinger{
+		s:       s,
+		si:      si,
+		listen:  make(chan []byte),
+		waiters: make(map[pingKey]chan time.Time),
+	}
+
+	si.pg = pg
+	return nil
+}
+
+func (pg *pinger) runListener(ctx context.Context) error {
+	var decodedLayers []gopacket.LayerType
+	var eth layers.Ethernet
+	var dot1q layers.Dot1Q
+	var ip layers.IPv4
+	var icmp layers.ICMPv4
+	var payload gopacket.Payload
+
+	parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet,
+		&eth,
+		&dot1q,
+		&ip,
+		&icmp,
+		&payload)
+
+	parse := func(raw []byte) {
+		// echo replies are rare, therefore errors are not counted
+		if err := parser.DecodeLayers(raw, &decodedLayers); err != nil {
+			return
+		}
+
+		if icmp.TypeCode.Type() != layers.ICMPv4TypeEchoReply {
+			return
+		}
+
+		now := time.Now()
+
+		pg.mutex.Lock()
+		defer pg.mutex.Unlock()
+
+		if ch, ok := pg.waiters[newPingKey(ip.SrcIP, icmp.Id)]; ok {
+			select {
+			case ch <- now:
+			default:
+			}
+		}
+	}
+
+	for {
+		select {
+		case raw := <-pg.listen:
+			parse(raw)
+
+			select {
+			case pg.si.ls.listenDone <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ping sends an ICMP echo request and waits for the reply until the context is done.
+func (pg *pinger) ping(ctx context.Context, destMac net.HardwareAddr, destIP net.IP) (time.Duration, error) {
+	id, err := randUint16()
+	if err != nil {
+		return 0, err
+	}
+
+	key := newPingKey(destIP, id)
+	reply := make(chan time.Time, 1)
+
+	pg.mutex.Lock()
+	pg.waiters[key] = reply
+	pg.mutex.Unlock()
+
+	defer func() {
+		pg.mutex.Lock()
+		delete(pg.waiters, key)
+		pg.mutex.Unlock()
+	}()
+
+	eth := layers.Ethernet{
+		SrcMAC:       pg.si.intf.HardwareAddr,
+		DstMAC:       destMac,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Id:       id,
+		Protocol: layers.IPProtocolICMPv4,
+		SrcIP:    pg.si.ownIP,
+		DstIP:    destIP,
+	}
+	icmp := layers.ICMPv4{
+		TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0),
+		Id:       id,
+		Seq:      1,
+	}
+	payload := gopacket.Payload(make([]byte, 32))
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+
+	err = gopacket.SerializeLayers(buf, opts, &eth, &ip, &icmp, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+
+	err = pg.si.ls.socket.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case t := <-reply:
+		return t.Sub(start), nil
+
+	case <-ctx.Done():
+		return 0, fmt.Errorf("no reply from %s", destIP)
+	}
+}
@@ -0,0 +1,278 @@
+package discover
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// enough to probe every node of a /24 subnet at once
+	probeQueueSize = 256
+
+	// DNS lookups are performed by the system resolver and can take seconds
+	dnsProbeWorkers = 8
+
+	defaultProbeTimeout  = 2 * time.Second
+	defaultProbeAttempts = 3
+
+	// timeouts are checked a few times per ProbeTimeout
+	probeChecksPerTimeout = 4
+	minProbeCheckPeriod   = 10 * time.Millisecond
+)
+
+// ProbeState is the state of the name requests of a method sent to a node.
+type ProbeState int
+
+// probe states.
+const (
+	// ProbeNone means that no request was sent, i.e. in passive mode,
+	// or NetBIOS requests to nodes of tagged VLANs.
+	ProbeNone ProbeState = iota
+
+	// ProbePending means that a request is queued or waiting for a reply.
+	ProbePending
+
+	// ProbeAnswered means that the node replied.
+	ProbeAnswered
+
+	// ProbeNoResponse means that the node did not reply to any attempt.
+	ProbeNoResponse
+)
+
+// String implements fmt.Stringer.
+func (ps ProbeState) String() string {
+	switch ps {
+	case ProbeNone:
+		return "none"
+	case ProbePending:
+		return "pending"
+	case ProbeAnswered:
+		return "answered"
+	case ProbeNoResponse:
+		return "noresponse"
+	}
+	return "unknown"
+}
+
+// ProbeStatus is the status of the name requests of a method sent to a node.
+type ProbeStatus struct {
+	State ProbeState
+
+	// Attempts is the number of requests sent.
+	Attempts int
+
+	// LastAttempt is the time of the last request.
+	LastAttempt time.Time
+
+	queued bool
+	txid   uint16
+}
+
+// NodeProbes is the status of the name requests sent to a node.
+type NodeProbes struct {
+	DNS  ProbeStatus
+	MDNS ProbeStatus
+	NBNS ProbeStatus
+}
+
+type probeReq struct {
+	key  nodeKey
+	mac  net.HardwareAddr
+	ip   net.IP
+	txid uint16
+}
+
+type probeSentReq struct {
+	method string
+	key    nodeKey
+	time   time.Time
+}
+
+// probeQueue sends per-node requests of a method with bounded concurrency.
+// It shares the rate limiter of the method with periodic requests, but takes
+// tokens before them, in order not to wait behind a whole sweep.
+type probeQueue struct {
+	s       *Scanner
+	method  string
+	workers int
+	send    func(ctx context.Context, req probeReq) error
+
+	queue chan probeReq
+}
+
+func newProbeQueue(s *Scanner, method string, workers int,
+	send func(ctx context.Context, req probeReq) error,
+) *probeQueue {
+	return &probeQueue{
+		s:       s,
+		method:  method,
+		workers: workers,
+		send:    send,
+		queue:   make(chan probeReq, probeQueueSize),
+	}
+}
+
+// push enqueues a request. It never blocks; it returns false when the queue is full.
+func (pq *probeQueue) push(req probeReq) bool {
+	select {
+	case pq.queue <- req:
+		return true
+	default:
+		return false
+	}
+}
+
+func (pq *probeQueue) run(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	for i := 0; i < pq.workers; i++ {
+		g.Go(func() error { return pq.runWorker(ctx) })
+	}
+
+	return g.Wait()
+}
+
+func (pq *probeQueue) runWorker(ctx context.Context) error {
+	for {
+		select {
+		case req := <-pq.queue:
+			if !pq.s.waitProbeRate(ctx, pq.method) {
+				return nil
+			}
+
+			// the timeout starts when the request is sent, not when it is queued
+			select {
+			case pq.s.probeSent <- probeSentReq{method: pq.method, key: req.key, time: time.Now()}:
+			case <-ctx.Done():
+				return nil
+			}
+
+			err := pq.send(ctx, req)
+			if err != nil {
+				return err
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// probeTracker schedules the name requests of every node and retries them
+// with exponential backoff. It is owned by the runNodes goroutine.
+type probeTracker struct {
+	s        *Scanner
+	timeout  time.Duration
+	attempts int
+}
+
+// checkPeriod returns how often timeouts are checked.
+func (pt *probeTracker) checkPeriod() time.Duration {
+	return max(pt.timeout/probeChecksPerTimeout, minProbeCheckPeriod)
+}
+
+func (pt *probeTracker) queue(method string) *probeQueue {
+	switch method {
+	case "dns":
+		return pt.s.dnsProbes
+	case "mdns":
+		return pt.s.mdnsProbes
+	}
+	return pt.s.nbnsProbes
+}
+
+func probeStatus(n *Node, method string) *ProbeStatus {
+	switch method {
+	case "dns":
+		return &n.Probes.DNS
+	case "mdns":
+		return &n.Probes.MDNS
+	}
+	return &n.Probes.NBNS
+}
+
+var probeMethods = []string{"dns", "mdns", "nbns"}
+
+// start marks every enabled method of a new node as pending and enqueues the first requests.
+func (pt *probeTracker) start(key nodeKey, n *Node) {
+	for _, method := range probeMethods {
+		if !pt.s.methods[method] {
+			continue
+		}
+
+		// replies would be addressed to an IP we don't have
+		if method == "nbns" && key.vlan != 0 {
+			continue
+		}
+
+		probeStatus(n, method).State = ProbePending
+		pt.enqueue(key, n, method)
+	}
+}
+
+func (pt *probeTracker) enqueue(key nodeKey, n *Node, method string) {
+	ps := probeStatus(n, method)
+
+	req := probeReq{key: key, mac: n.MAC, ip: n.IP}
+
+	if method == "nbns" {
+		// a new transaction ID is used for every attempt
+		txid, err := randUint16()
+		if err != nil {
+			return
+		}
+		req.txid = txid
+	}
+
+	// if the queue is full, the request is enqueued again by the next check
+	if pt.queue(method).push(req) {
+		ps.queued = true
+		ps.txid = req.txid
+	}
+}
+
+// sent is called when a queued request is sent.
+func (pt *probeTracker) sent(n *Node, req probeSentReq) {
+	ps := probeStatus(n, req.method)
+	if ps.State != ProbePending {
+		return
+	}
+
+	ps.queued = false
+	ps.Attempts++
+	ps.LastAttempt = req.time
+}
+
+// check retries requests that timed out, or gives up after the last attempt.
+func (pt *probeTracker) check(key nodeKey, n *Node, now time.Time) {
+	for _, method := range probeMethods {
+		ps := probeStatus(n, method)
+		if ps.State != ProbePending || ps.queued {
+			continue
+		}
+
+		if ps.Attempts != 0 && now.Sub(ps.LastAttempt) < pt.timeout<<(ps.Attempts-1) {
+			continue
+		}
+
+		if ps.Attempts >= pt.attempts {
+			ps.State = ProbeNoResponse
+			continue
+		}
+
+		pt.enqueue(key, n, method)
+	}
+}
+
+// answered is called when a reply to a request is received.
+// Late replies are accepted too.
+func answered(n *Node, method string) {
+	ps := probeStatus(n, method)
+	if ps.State == ProbePending || ps.State == ProbeNoResponse {
+		ps.State = ProbeAnswered
+		ps.queued = false
+	}
+}
@@ -0,0 +1,123 @@
+package discover
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Rate is a limit on the number of packets sent per second.
+type Rate struct {
+	// PacketsPerSecond is the sustained rate. Zero disables the limit.
+	PacketsPerSecond float64
+
+	// Burst is the number of packets that can be sent at once.
+	// It defaults to 1.
+	Burst int
+}
+
+// DefaultRates returns the default rate limits of each method,
+// indexed by method name ("arp", "mdns", "nbns", "dns", "dhcp").
+func DefaultRates() map[string]Rate {
+	return map[string]Rate{
+		// more results if there's a minimum delay between arps
+		"arp": {PacketsPerSecond: 20, Burst: 1},
+
+		// about 1 minute for a full scan
+		"mdns": {PacketsPerSecond: 5, Burst: 1},
+
+		"nbns": {PacketsPerSecond: 20, Burst: 5},
+		"dns":  {PacketsPerSecond: 20, Burst: 5},
+		"dhcp": {PacketsPerSecond: 1, Burst: 1},
+	}
+}
+
+// tokenBucket is a rate limiter that can be shared by multiple goroutines.
+// Goroutines that call waitFirst take tokens before the ones that call wait.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+	first  int // goroutines waiting in waitFirst
+}
+
+func newTokenBucket(r Rate) *tokenBucket {
+	burst := float64(r.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   r.PacketsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// take consumes a token, or returns how long to wait before one is available.
+// Tokens are left to waitFirst when first is false and someone is waiting there.
+func (tb *tokenBucket) take(first bool) time.Duration {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	now := time.Now()
+	tb.tokens = min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+
+	if !first && tb.first > 0 {
+		return time.Duration(float64(time.Second) / tb.rate)
+	}
+
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// wait blocks until a token is available.
+// It returns false if the context is canceled before.
+func (tb *tokenBucket) wait(ctx context.Context) bool {
+	return tb.waitToken(ctx, false)
+}
+
+// waitFirst is like wait, but takes tokens before goroutines that are in wait.
+func (tb *tokenBucket) waitFirst(ctx context.Context) bool {
+	if tb.rate <= 0 {
+		return ctx.Err() == nil
+	}
+
+	tb.mutex.Lock()
+	tb.first++
+	tb.mutex.Unlock()
+
+	defer func() {
+		tb.mutex.Lock()
+		tb.first--
+		tb.mutex.Unlock()
+	}()
+
+	return tb.waitToken(ctx, true)
+}
+
+func (tb *tokenBucket) waitToken(ctx context.Context, first bool) bool {
+	if tb.rate <= 0 {
+		return ctx.Err() == nil
+	}
+
+	for {
+		d := tb.take(first)
+		if d == 0 {
+			return true
+		}
+
+		if !sleep(ctx, d) {
+			return false
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package discover
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tb := newTokenBucket(Rate{PacketsPerSecond: 50, Burst: 3})
+
+	ctx := context.Background()
+	start := time.Now()
+
+	for i := 0; i < 5; i++ {
+		if !tb.wait(ctx) {
+			t.Fatal("wait failed")
+		}
+	}
+
+	// 3 tokens are available immediately, 2 require 20ms each
+	if d := time.Since(start); d < 35*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("unexpected duration: %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if tb.wait(ctx) {
+		t.Error("wait succeeded with a canceled context")
+	}
+
+	unlimited := newTokenBucket(Rate{})
+	for i := 0; i < 1000; i++ {
+		if !unlimited.wait(context.Background()) {
+			t.Fatal("wait failed")
+		}
+	}
+}
+
+func TestTokenBucketFirst(t *testing.T) {
+	tb := newTokenBucket(Rate{PacketsPerSecond: 100, Burst: 1})
+	tb.take(false)
+
+	ctx := context.Background()
+	order := make(chan string, 4)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			tb.wait(ctx)
+			order <- "wait"
+		}()
+	}
+
+	// let the goroutines above wait for the next token
+	time.Sleep(2 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			tb.waitFirst(ctx)
+			order <- "first"
+		}()
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, <-order)
+	}
+
+	if got[0] != "first" || got[1] != "first" {
+		t.Errorf("unexpected order: %v", got)
+	}
+}
@@ -0,0 +1,167 @@
+package discover
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// size of struct tpacket_auxdata
+const auxdataSize = 20
+
+// rawSocket is a packetConn bound to a network interface.
+// The socket is registered with the runtime poller, therefore Close() unblocks a pending Read().
+//
+// VLAN tags are usually stripped by the kernel and provided as auxiliary data,
+// therefore they are inserted back into received frames.
+type rawSocket struct {
+	f     *os.File
+	rc    syscall.RawConn
+	buf   []byte
+	oob   []byte
+	drops atomic.Uint64
+}
+
+func newRawSocket(intf *net.Interface) (*rawSocket, error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET,
+		syscall.SOCK_RAW|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC,
+		int(htons(syscall.ETH_P_ALL)))
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) {
+			return nil, fmt.Errorf("unable to open raw socket: %w (the CAP_NET_RAW capability is required)", err)
+		}
+		return nil, fmt.Errorf("unable to open raw socket: %w", err)
+	}
+
+	err = syscall.Bind(fd, &syscall.SockaddrLinklayer{
+		Protocol: htons(syscall.ETH_P_ALL),
+		Ifindex:  intf.Index,
+	})
+	if err != nil {
+		syscall.Close(fd) //nolint:errcheck
+		return nil, fmt.Errorf("unable to bind raw socket to %s: %w", intf.Name, err)
+	}
+
+	err = syscall.SetsockoptInt(fd, syscall.SOL_PACKET, unix.PACKET_AUXDATA, 1)
+	if err != nil {
+		syscall.Close(fd) //nolint:errcheck
+		return nil, fmt.Errorf("unable to enable auxiliary data: %w", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "packet:"+intf.Name)
+
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	return &rawSocket{
+		f:   f,
+		rc:  rc,
+		buf: make([]byte, 65536),
+		oob: make([]byte, syscall.CmsgSpace(auxdataSize)),
+	}, nil
+}
+
+func (s *rawSocket) Close() error {
+	return s.f.Close()
+}
+
+func (s *rawSocket) Read() ([]byte, error) {
+	var n, oobn int
+	var err2 error
+
+	// the frame is read after 4 bytes, in order to make room for the VLAN tag
+	err := s.rc.Read(func(fd uintptr) bool {
+		n, oobn, _, _, err2 = syscall.Recvmsg(int(fd), s.buf[4:], s.oob, 0)
+		return err2 != syscall.EAGAIN
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err2 != nil {
+		return nil, err2
+	}
+
+	frame := s.buf[4 : 4+n]
+
+	tci, tpid, ok := parseAuxdataVLAN(s.oob[:oobn])
+	if ok && n >= 12 {
+		frame = insertVLANTag(s.buf[:4+n], tci, tpid)
+	}
+
+	return frame, nil
+}
+
+func (s *rawSocket) Write(byts []byte) error {
+	_, err := s.f.Write(byts)
+	return err
+}
+
+// Drops returns the number of frames dropped by the kernel since the socket was opened.
+func (s *rawSocket) Drops() (uint64, error) {
+	var st *unix.TpacketStats
+	var err2 error
+	err := s.rc.Control(func(fd uintptr) {
+		st, err2 = unix.GetsockoptTpacketStats(int(fd), unix.SOL_PACKET, unix.PACKET_STATISTICS)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err2 != nil {
+		return 0, err2
+	}
+
+	// kernel counters are reset after every read
+	return s.drops.Add(uint64(st.Drops)), nil
+}
+
+// parseAuxdataVLAN returns the VLAN tag contained in the auxiliary data of a frame.
+func parseAuxdataVLAN(oob []byte) (uint16, uint16, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	for _, msg := range msgs {
+		if msg.Header.Level != syscall.SOL_PACKET || msg.Header.Type != unix.PACKET_AUXDATA ||
+			len(msg.Data) < auxdataSize {
+			continue
+		}
+
+		status := binary.NativeEndian.Uint32(msg.Data[0:])
+		if (status & unix.TP_STATUS_VLAN_VALID) == 0 {
+			return 0, 0, false
+		}
+
+		tci := binary.NativeEndian.Uint16(msg.Data[16:])
+		tpid := uint16(syscall.ETH_P_8021Q)
+		if (status & unix.TP_STATUS_VLAN_TPID_VALID) != 0 {
+			tpid = binary.NativeEndian.Uint16(msg.Data[18:])
+		}
+
+		return tci, tpid, true
+	}
+
+	return 0, 0, false
+}
+
+// insertVLANTag inserts a VLAN tag after the MAC addresses of a frame.
+// buf must contain 4 free bytes followed by the frame.
+func insertVLANTag(buf []byte, tci uint16, tpid uint16) []byte {
+	copy(buf[0:12], buf[4:16])
+	binary.BigEndian.PutUint16(buf[12:], tpid)
+	binary.BigEndian.PutUint16(buf[14:], tci)
+	return buf
+}
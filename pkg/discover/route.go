@@ -0,0 +1,77 @@
+package discover
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	routeFlagUp      = 0x1
+	routeFlagGateway = 0x2
+)
+
+// defaultGateway returns the default gateway of an interface, or nil if there's none.
+func defaultGateway(intfName string) (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseRouteTable(f, intfName)
+}
+
+// parseRouteTable finds the default route with the lowest metric in a table
+// in the /proc/net/route format.
+func parseRouteTable(r io.Reader, intfName string) (net.IP, error) {
+	var ret net.IP
+	var retMetric uint64
+
+	sc := bufio.NewScanner(r)
+
+	// skip header
+	sc.Scan()
+
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 8 || fields[0] != intfName {
+			continue
+		}
+
+		// destination and mask must be 0.0.0.0
+		if fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[3], 16, 16)
+		if err != nil || (flags&routeFlagUp) == 0 || (flags&routeFlagGateway) == 0 {
+			continue
+		}
+
+		metric, err := strconv.ParseUint(fields[6], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		// addresses are printed as integers in host byte order,
+		// whose memory representation is the address in network byte order
+		v, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.NativeEndian.PutUint32(ip, uint32(v))
+
+		if ret == nil || metric < retMetric {
+			ret = ip
+			retMetric = metric
+		}
+	}
+
+	return ret, sc.Err()
+}
@@ -0,0 +1,40 @@
+package discover
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseRouteTable(t *testing.T) {
+	// addresses are printed by the kernel as integers in host byte order
+	addr := func(ip net.IP) string {
+		return fmt.Sprintf("%08X", binary.NativeEndian.Uint32(ip.To4()))
+	}
+
+	table := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+		"eth0\t00000000\t" + addr(net.IP{192, 168, 1, 1}) + "\t0003\t0\t0\t600\t00000000\t0\t0\t0\n" +
+		"eth0\t00000000\t" + addr(net.IP{192, 168, 1, 2}) + "\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+		"eth0\t" + addr(net.IP{192, 168, 1, 0}) + "\t00000000\t0001\t0\t0\t100\t" +
+		addr(net.IP{255, 255, 255, 0}) + "\t0\t0\t0\n" +
+		"wlan0\t00000000\t" + addr(net.IP{192, 168, 10, 1}) + "\t0003\t0\t0\t50\t00000000\t0\t0\t0\n"
+
+	for _, ca := range []struct {
+		intf string
+		gw   net.IP
+	}{
+		{"eth0", net.IP{192, 168, 1, 2}},
+		{"wlan0", net.IP{192, 168, 10, 1}},
+		{"eth1", nil},
+	} {
+		gw, err := parseRouteTable(strings.NewReader(table), ca.intf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !gw.Equal(ca.gw) {
+			t.Errorf("%s: expected %v, got %v", ca.intf, ca.gw, gw)
+		}
+	}
+}
@@ -0,0 +1,1124 @@
+// Package discover contains a machine and service discovery engine
+// that combines ARP, DNS, mDNS and NetBIOS.
+package discover
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+type nodeKey struct {
+	intf int
+	vlan uint16
+	mac  [6]byte
+	ip   [4]byte
+}
+
+func newNodeKey(mac []byte, ip []byte) nodeKey {
+	key := nodeKey{}
+	copy(key.mac[:], mac)
+	copy(key.ip[:], ip)
+	return key
+}
+
+// errScanComplete stops the scanner in once mode.
+var errScanComplete = errors.New("scan complete")
+
+const (
+	defaultGracePeriod    = 3 * time.Second
+	defaultOfflineTimeout = 2 * time.Minute
+	defaultScanInterval   = 10 * time.Second
+	offlineCheckPeriod    = 1 * time.Second
+
+	// a /16 range is swept in about one hour with the default rate
+	minRangePrefix = 16
+)
+
+// requestMethods are the methods that can be enabled with Options.Methods.
+var requestMethods = []string{"arp", "dns", "mdns", "nbns"}
+
+// Node is a machine found in the local network.
+type Node struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Online    bool
+	MAC       net.HardwareAddr
+	IP        net.IP
+	DNS       string
+	NBNS      string
+	MDNS      string
+
+	// Interface is the name of the interface the node was found on.
+	Interface string
+
+	// VLAN is the VLAN ID of the frames of the node, or zero if they are not tagged.
+	VLAN uint16
+
+	// Gateway is true when the node has the IP of the gateway.
+	Gateway bool
+
+	// Probes is the status of the name requests sent to the node.
+	Probes NodeProbes
+
+	// Method is the name of the method that found the node ("arp", "mdns" or "nbns").
+	Method string
+
+	// Sightings is the number of frames received from the node.
+	Sightings int
+
+	// TTL is the IP time to live of the last NetBIOS reply of the node,
+	// or zero if the node never replied. It hints at the operating system.
+	TTL uint8
+
+	// Services are the mDNS service types announced by the node, like "_http._tcp".
+	Services []string
+}
+
+// EventType is the type of an Event.
+type EventType int
+
+// event types.
+const (
+	// EventNew is emitted when a node is found for the first time.
+	EventNew EventType = iota
+
+	// EventUpdate is emitted when a name of a node changes.
+	EventUpdate
+
+	// EventIPChange is emitted instead of EventNew when a known MAC address
+	// is found with a new IP.
+	EventIPChange
+
+	// EventOffline is emitted when a node has not been seen for Options.OfflineTimeout.
+	EventOffline
+
+	// EventOnline is emitted when an offline node is seen again.
+	EventOnline
+
+	// EventAlert is emitted when a suspicious condition is detected in ARP traffic.
+	// Node is the sender of the ARP frame that raised the alert.
+	EventAlert
+)
+
+// String implements fmt.Stringer.
+func (t EventType) String() string {
+	switch t {
+	case EventNew:
+		return "new"
+	case EventUpdate:
+		return "update"
+	case EventIPChange:
+		return "ipchange"
+	case EventOffline:
+		return "offline"
+	case EventOnline:
+		return "online"
+	case EventAlert:
+		return "alert"
+	}
+	return "unknown"
+}
+
+// Event is a change in the node table.
+type Event struct {
+	Type EventType
+	Node Node
+
+	// Previous is the state of the node before an EventUpdate,
+	// or the node previously associated with the MAC address in case of EventIPChange.
+	Previous *Node
+
+	// Alert is filled in case of EventAlert.
+	Alert *Alert
+}
+
+// Options are the Scanner options.
+type Options struct {
+	// Interface to listen to. If it is empty, and Interfaces and AllInterfaces are not set,
+	// the first suitable interface is used.
+	Interface string
+
+	// Interfaces are additional interfaces to listen to.
+	Interfaces []string
+
+	// AllInterfaces makes the scanner listen to every suitable interface.
+	AllInterfaces bool
+
+	// Passive disables sending packets.
+	Passive bool
+
+	// Methods are the methods used to send requests ("arp", "dns", "mdns", "nbns").
+	// By default, all of them are used. Replies are monitored anyway.
+	Methods []string
+
+	// Ranges are the subnets swept by ARP. They default to the /24 subnet of each interface.
+	// Ranges are swept on the interfaces whose subnet overlaps with them,
+	// or on every interface if there's none.
+	Ranges []*net.IPNet
+
+	// VLANs are probed with tagged frames on every interface, in addition to
+	// the untagged network. Tagged frames are decoded even if they are not listed.
+	VLANs []VLAN
+
+	// DHCPProbe enables sending DHCPDISCOVER requests, in order to find DHCP servers
+	// without waiting for other clients. DHCP replies are always monitored.
+	DHCPProbe bool
+
+	// AllowedDHCPServers are the MAC addresses or IPs of legitimate DHCP servers.
+	// If not empty, other servers raise an AlertRogueDHCP.
+	AllowedDHCPServers []string
+
+	// Gateway is the IP of the gateway. Its MAC address is monitored
+	// and an alert is raised when it changes.
+	// If empty, it is read from the routing table of each interface.
+	// When there are multiple interfaces, it is used by the one on the same subnet.
+	Gateway net.IP
+
+	// Rates are the rate limits of each method, indexed by method name
+	// ("arp", "mdns", "nbns", "dns", "dhcp"). Missing methods use DefaultRates().
+	// Name requests sent to discovered nodes share the limit of their method
+	// with periodic requests, and are sent first.
+	Rates map[string]Rate
+
+	// GlobalRate is a rate limit shared by all methods.
+	// By default, there's no global limit.
+	GlobalRate Rate
+
+	// ScanInterval is the pause between two ARP sweeps. It defaults to 10 seconds.
+	ScanInterval time.Duration
+
+	// Retries is the number of times an ARP request is sent again
+	// to IPs that did not reply during a sweep.
+	Retries int
+
+	// Once makes Run return after a single ARP sweep.
+	// It is not available in passive mode.
+	Once bool
+
+	// GracePeriod is the time Run waits after the sweep in once mode,
+	// in order to receive replies to name requests. It defaults to 3 seconds.
+	GracePeriod time.Duration
+
+	// OfflineTimeout is the duration after which a node that has not been seen
+	// is considered offline. It defaults to 2 minutes.
+	OfflineTimeout time.Duration
+
+	// ProbeTimeout is the time to wait for a reply to a name request
+	// before sending it again. It doubles after every attempt. It defaults to 2 seconds.
+	ProbeTimeout time.Duration
+
+	// ProbeAttempts is the number of name requests sent to a node
+	// for each method before giving up. It defaults to 3.
+	ProbeAttempts int
+
+	// OnEvent, if not nil, is called for every event.
+	// It is called by the Run goroutine and must not block.
+	OnEvent func(Event)
+}
+
+type arpReq struct {
+	si         *scanIntf
+	vlan       uint16
+	srcMac     net.HardwareAddr
+	srcIP      net.IP
+	gratuitous bool
+}
+
+type dnsReq struct {
+	key nodeKey
+
+	// dns is empty when the address has no name.
+	dns string
+}
+
+type mdnsReq struct {
+	si         *scanIntf
+	vlan       uint16
+	srcMac     net.HardwareAddr
+	srcIP      net.IP
+	domainName string
+	services   []string
+}
+
+type nbnsReq struct {
+	si     *scanIntf
+	vlan   uint16
+	srcMac net.HardwareAddr
+	srcIP  net.IP
+	name   string
+	txid   uint16
+	ttl    uint8
+}
+
+type getNodesReq struct {
+	res chan []Node
+}
+
+type getAlertsReq struct {
+	res chan []Alert
+}
+
+type reprobeReq struct {
+	key nodeKey
+	res chan error
+}
+
+type getDHCPServersReq struct {
+	res chan []DHCPServer
+}
+
+// Scanner discovers machines in the local network.
+type Scanner struct {
+	passiveMode    bool
+	methods        map[string]bool
+	dhcpProbe      bool
+	allowedDHCP    []string
+	scanInterval   time.Duration
+	retries        int
+	once           bool
+	gracePeriod    time.Duration
+	offlineTimeout time.Duration
+	probes         probeTracker
+	onEvent        func(Event)
+	intfs          []*scanIntf
+	lookupAddr     func(ctx context.Context, addr string) ([]string, error)
+	limiters       map[string]*tokenBucket
+	globalLimiter  *tokenBucket
+	dnsProbes      *probeQueue
+	mdnsProbes     *probeQueue
+	nbnsProbes     *probeQueue
+	probeSent      chan probeSentReq
+	stats          stats
+	complete       atomic.Bool
+
+	arp            chan arpReq
+	dns            chan dnsReq
+	mdns           chan mdnsReq
+	nbns           chan nbnsReq
+	dhcp           chan dhcpReq
+	getNodes       chan getNodesReq
+	getAlerts      chan getAlertsReq
+	getDHCPServers chan getDHCPServersReq
+	reprobe        chan reprobeReq
+	done           chan struct{}
+}
+
+// NewScanner allocates a Scanner and opens a raw socket on each interface.
+// Opening sockets requires the CAP_NET_RAW capability, that is not needed afterwards.
+// Sockets are released when Run returns.
+func NewScanner(opts Options) (*Scanner, error) {
+	intfNames, err := func() ([]string, error) {
+		if opts.AllInterfaces {
+			return allInterfaceNames()
+		}
+
+		var ret []string
+		if opts.Interface != "" {
+			ret = append(ret, opts.Interface)
+		}
+		ret = append(ret, opts.Interfaces...)
+
+		if len(ret) == 0 {
+			name, err := defaultInterfaceName()
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, name)
+		}
+
+		return ret, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	var bound []boundSocket
+
+	closeAll := func() {
+		for _, b := range bound {
+			b.socket.Close() //nolint:errcheck
+		}
+	}
+
+	for _, name := range intfNames {
+		b, err := bindInterface(name, opts.Gateway, len(intfNames) == 1)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		bound = append(bound, b)
+	}
+
+	s, err := newScanner(opts, bound)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// newScanner allocates a Scanner that exchanges frames through the given sockets.
+func newScanner(opts Options, bound []boundSocket) (*Scanner, error) {
+	if opts.OfflineTimeout == 0 {
+		opts.OfflineTimeout = defaultOfflineTimeout
+	}
+
+	if opts.ScanInterval == 0 {
+		opts.ScanInterval = defaultScanInterval
+	}
+
+	methods := make(map[string]bool)
+	if opts.Methods == nil {
+		opts.Methods = requestMethods
+	}
+	for _, method := range opts.Methods {
+		if !slices.Contains(requestMethods, method) {
+			return nil, fmt.Errorf("invalid method: %s", method)
+		}
+		methods[method] = true
+	}
+
+	if opts.Once && opts.Passive {
+		return nil, fmt.Errorf("once mode is not available in passive mode")
+	}
+
+	if opts.Once && !methods["arp"] {
+		return nil, fmt.Errorf("once mode requires the arp method")
+	}
+
+	for _, r := range opts.Ranges {
+		if _, bits := r.Mask.Size(); r.IP.To4() == nil || bits != 32 {
+			return nil, fmt.Errorf("invalid range: %s", r)
+		}
+		if ones, _ := r.Mask.Size(); ones < minRangePrefix {
+			return nil, fmt.Errorf("range %s is too large, the minimum prefix length is %d", r, minRangePrefix)
+		}
+	}
+
+	seenVLANs := make(map[uint16]struct{})
+	for _, v := range opts.VLANs {
+		if v.ID == 0 || v.ID > maxVLANID {
+			return nil, fmt.Errorf("invalid VLAN ID: %d", v.ID)
+		}
+		if _, ok := seenVLANs[v.ID]; ok {
+			return nil, fmt.Errorf("VLAN %d is provided twice", v.ID)
+		}
+		seenVLANs[v.ID] = struct{}{}
+
+		for _, r := range v.Ranges {
+			if _, bits := r.Mask.Size(); r.IP.To4() == nil || bits != 32 {
+				return nil, fmt.Errorf("invalid range: %s", r)
+			}
+			if ones, _ := r.Mask.Size(); ones < minRangePrefix {
+				return nil, fmt.Errorf("range %s is too large, the minimum prefix length is %d", r, minRangePrefix)
+			}
+		}
+	}
+
+	if opts.GracePeriod == 0 {
+		opts.GracePeriod = defaultGracePeriod
+	}
+
+	if opts.ProbeTimeout == 0 {
+		opts.ProbeTimeout = defaultProbeTimeout
+	}
+
+	if opts.ProbeAttempts == 0 {
+		opts.ProbeAttempts = defaultProbeAttempts
+	}
+
+	rates := DefaultRates()
+	for method, r := range opts.Rates {
+		if _, ok := rates[method]; !ok {
+			return nil, fmt.Errorf("invalid method: %s", method)
+		}
+		if r.PacketsPerSecond < 0 || r.Burst < 0 {
+			return nil, fmt.Errorf("invalid rate for %s", method)
+		}
+		rates[method] = r
+	}
+
+	if opts.GlobalRate.PacketsPerSecond < 0 || opts.GlobalRate.Burst < 0 {
+		return nil, fmt.Errorf("invalid global rate")
+	}
+
+	limiters := make(map[string]*tokenBucket)
+	for method, r := range rates {
+		limiters[method] = newTokenBucket(r)
+	}
+
+	for _, a := range opts.AllowedDHCPServers {
+		if _, err := net.ParseMAC(a); err != nil && net.ParseIP(a) == nil {
+			return nil, fmt.Errorf("invalid DHCP server: %s", a)
+		}
+	}
+
+	s := &Scanner{
+		passiveMode:    opts.Passive,
+		methods:        methods,
+		dhcpProbe:      opts.DHCPProbe,
+		allowedDHCP:    opts.AllowedDHCPServers,
+		scanInterval:   opts.ScanInterval,
+		retries:        opts.Retries,
+		once:           opts.Once,
+		gracePeriod:    opts.GracePeriod,
+		offlineTimeout: opts.OfflineTimeout,
+		onEvent:        opts.OnEvent,
+		limiters:       limiters,
+		globalLimiter:  newTokenBucket(opts.GlobalRate),
+		lookupAddr:     net.DefaultResolver.LookupAddr,
+		arp:            make(chan arpReq),
+		dns:            make(chan dnsReq),
+		mdns:           make(chan mdnsReq),
+		nbns:           make(chan nbnsReq),
+		dhcp:           make(chan dhcpReq),
+		probeSent:      make(chan probeSentReq),
+		getNodes:       make(chan getNodesReq),
+		getAlerts:      make(chan getAlertsReq),
+		getDHCPServers: make(chan getDHCPServersReq),
+		reprobe:        make(chan reprobeReq),
+		done:           make(chan struct{}),
+	}
+
+	seen := make(map[string]struct{})
+
+	for i, b := range bound {
+		if _, ok := seen[b.intf.Name]; ok {
+			return nil, fmt.Errorf("interface %s is provided twice", b.intf.Name)
+		}
+		seen[b.intf.Name] = struct{}{}
+
+		si := &scanIntf{
+			index:     i,
+			intf:      b.intf,
+			ownIP:     b.ownIP,
+			gatewayIP: b.gateway.To4(),
+			watches:   make(map[uint16]*arpWatch),
+		}
+
+		if opts.Ranges == nil {
+			si.ranges = []*net.IPNet{si.subnet()}
+		} else {
+			for _, r := range opts.Ranges {
+				if rangesOverlap(r, si.subnet()) {
+					si.ranges = append(si.ranges, r)
+				}
+			}
+		}
+
+		err := newListener(s, si, b.socket)
+		if err != nil {
+			return nil, err
+		}
+
+		err = newMethodArp(s, si)
+		if err != nil {
+			return nil, err
+		}
+
+		err = newMethodMdns(s, si)
+		if err != nil {
+			return nil, err
+		}
+
+		err = newMethodNbns(s, si)
+		if err != nil {
+			return nil, err
+		}
+
+		err = newMethodDhcp(s, si)
+		if err != nil {
+			return nil, err
+		}
+
+		err = newPinger(s, si)
+		if err != nil {
+			return nil, err
+		}
+
+		s.intfs = append(s.intfs, si)
+	}
+
+	// ranges that are not on any subnet are swept on every interface
+	for _, r := range opts.Ranges {
+		found := false
+		for _, si := range s.intfs {
+			if slices.Contains(si.ranges, r) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			for _, si := range s.intfs {
+				si.ranges = append(si.ranges, r)
+			}
+		}
+	}
+
+	for _, si := range s.intfs {
+		si.targets = append(si.targets, vlanTarget{
+			ranges: si.ranges,
+		})
+
+		for _, v := range opts.VLANs {
+			si.targets = append(si.targets, vlanTarget{
+				vlan:   v.ID,
+				ranges: v.Ranges,
+			})
+		}
+	}
+
+	s.dnsProbes = newProbeQueue(s, "dns", dnsProbeWorkers, func(ctx context.Context, req probeReq) error {
+		s.dnsRequest(ctx, req.key, req.ip)
+		return nil
+	})
+	s.mdnsProbes = newProbeQueue(s, "mdns", 1, func(_ context.Context, req probeReq) error {
+		return s.intfs[req.key.intf].mm.request(req.key.vlan, req.ip)
+	})
+	s.nbnsProbes = newProbeQueue(s, "nbns", 1, func(_ context.Context, req probeReq) error {
+		return s.intfs[req.key.intf].mn.request(req.mac, req.ip, req.txid)
+	})
+	s.probes = probeTracker{
+		s:        s,
+		timeout:  opts.ProbeTimeout,
+		attempts: opts.ProbeAttempts,
+	}
+
+	return s, nil
+}
+
+// Interface returns the first interface the scanner is bound to.
+func (s *Scanner) Interface() *net.Interface {
+	return s.intfs[0].intf
+}
+
+// OwnIP returns the IP of the first interface the scanner is bound to.
+func (s *Scanner) OwnIP() net.IP {
+	return s.intfs[0].ownIP
+}
+
+// Gateway returns the IP of the gateway of the first interface, or nil if it is unknown.
+func (s *Scanner) Gateway() net.IP {
+	return s.intfs[0].gatewayIP
+}
+
+// Interfaces returns the interfaces the scanner is bound to.
+func (s *Scanner) Interfaces() []InterfaceInfo {
+	ret := make([]InterfaceInfo, len(s.intfs))
+	for i, si := range s.intfs {
+		ret[i] = InterfaceInfo{
+			Name:    si.intf.Name,
+			OwnIP:   si.ownIP,
+			Gateway: si.gatewayIP,
+		}
+	}
+	return ret
+}
+
+// Close releases the sockets of a Scanner that is not going to be run.
+// Run releases them by itself.
+func (s *Scanner) Close() {
+	for _, si := range s.intfs {
+		si.ls.socket.Close() //nolint:errcheck
+	}
+}
+
+// Passive returns whether the scanner is in passive mode.
+func (s *Scanner) Passive() bool {
+	return s.passiveMode
+}
+
+// Complete returns whether Run has returned because the scan of once mode is complete.
+func (s *Scanner) Complete() bool {
+	return s.complete.Load()
+}
+
+// Scan starts an ARP sweep of the subnet without waiting for the periodic one.
+// If a sweep is in progress, the new one starts as soon as it is complete.
+func (s *Scanner) Scan() error {
+	if s.passiveMode {
+		return fmt.Errorf("scanner is in passive mode")
+	}
+
+	if !s.methods["arp"] {
+		return fmt.Errorf("the arp method is disabled")
+	}
+
+	for _, si := range s.intfs {
+		si.ma.triggerScan()
+	}
+	return nil
+}
+
+// SweepProgress returns the progress of the ARP sweep, summed over all interfaces.
+// Sweeps is the number of sweeps completed by every interface.
+func (s *Scanner) SweepProgress() SweepProgress {
+	var ret SweepProgress
+
+	for i, si := range s.intfs {
+		p := si.ma.getProgress()
+		ret.Sent += p.Sent
+		ret.Total += p.Total
+		ret.Pass = max(ret.Pass, p.Pass)
+		if i == 0 || p.Sweeps < ret.Sweeps {
+			ret.Sweeps = p.Sweeps
+		}
+	}
+
+	return ret
+}
+
+// Nodes returns a snapshot of the node table.
+// It returns nil if the scanner is not running anymore.
+func (s *Scanner) Nodes() []Node {
+	res := make(chan []Node)
+	select {
+	case s.getNodes <- getNodesReq{res: res}:
+		return <-res
+	case <-s.done:
+		return nil
+	}
+}
+
+// Alerts returns the most recent alerts, oldest first.
+// It returns nil if the scanner is not running anymore.
+func (s *Scanner) Alerts() []Alert {
+	res := make(chan []Alert)
+	select {
+	case s.getAlerts <- getAlertsReq{res: res}:
+		return <-res
+	case <-s.done:
+		return nil
+	}
+}
+
+// DHCPServers returns the DHCP servers found.
+// It returns nil if the scanner is not running anymore.
+func (s *Scanner) DHCPServers() []DHCPServer {
+	res := make(chan []DHCPServer)
+	select {
+	case s.getDHCPServers <- getDHCPServersReq{res: res}:
+		return <-res
+	case <-s.done:
+		return nil
+	}
+}
+
+// intf returns the interface with the given name, or nil if the scanner is not bound to it.
+func (s *Scanner) intf(name string) *scanIntf {
+	for _, si := range s.intfs {
+		if si.intf.Name == name {
+			return si
+		}
+	}
+	return nil
+}
+
+// Reprobe sends the name requests to a node again, without waiting for
+// the next sweep, and an ARP request that refreshes its online status.
+// The ARP request is subject to the rate limits, like the ones of sweeps.
+func (s *Scanner) Reprobe(ctx context.Context, n Node) error {
+	if s.passiveMode {
+		return fmt.Errorf("scanner is in passive mode")
+	}
+
+	si := s.intf(n.Interface)
+	if si == nil {
+		return fmt.Errorf("interface %s not found", n.Interface)
+	}
+
+	res := make(chan error)
+	select {
+	case s.reprobe <- reprobeReq{key: si.nodeKey(n.VLAN, n.MAC, n.IP), res: res}:
+		err := <-res
+		if err != nil {
+			return err
+		}
+	case <-s.done:
+		return fmt.Errorf("scanner is not running")
+	}
+
+	if !s.methods["arp"] {
+		return nil
+	}
+
+	if !s.waitProbeRate(ctx, "arp") {
+		return ctx.Err()
+	}
+
+	return si.ma.request(n.VLAN, n.MAC, n.IP)
+}
+
+// Ping sends an ICMP echo request to a node and returns the round-trip time.
+// The reply is waited for Options.ProbeTimeout.
+func (s *Scanner) Ping(ctx context.Context, n Node) (time.Duration, error) {
+	if s.passiveMode {
+		return 0, fmt.Errorf("scanner is in passive mode")
+	}
+
+	// replies would be addressed to an IP we don't have
+	if n.VLAN != 0 {
+		return 0, fmt.Errorf("nodes of tagged VLANs cannot be pinged")
+	}
+
+	si := s.intf(n.Interface)
+	if si == nil {
+		return 0, fmt.Errorf("interface %s not found", n.Interface)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.probes.timeout)
+	defer cancel()
+
+	return si.pg.ping(ctx, n.MAC, n.IP)
+}
+
+// waitRate waits until the rate limits allow a packet of the given method to be sent.
+// It returns false if the context is canceled before.
+func (s *Scanner) waitRate(ctx context.Context, method string) bool {
+	return s.limiters[method].wait(ctx) && s.globalLimiter.wait(ctx)
+}
+
+// waitProbeRate is like waitRate, but takes tokens before periodic requests.
+func (s *Scanner) waitProbeRate(ctx context.Context, method string) bool {
+	return s.limiters[method].waitFirst(ctx) && s.globalLimiter.waitFirst(ctx)
+}
+
+// Run runs the scanner until the context is canceled or an error occurs.
+// It can be called only once.
+func (s *Scanner) Run(ctx context.Context) error {
+	defer close(s.done)
+
+	parentCtx := ctx
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		// unblock the listeners
+		<-ctx.Done()
+		for _, si := range s.intfs {
+			si.ls.socket.Close() //nolint:errcheck
+		}
+		return nil
+	})
+
+	for _, si := range s.intfs {
+		si := si
+		g.Go(func() error { return si.ls.run(ctx) })
+		g.Go(func() error { return si.ma.runListener(ctx) })
+		g.Go(func() error { return si.mm.runListener(ctx) })
+		g.Go(func() error { return si.mn.runListener(ctx) })
+		g.Go(func() error { return si.md.runListener(ctx) })
+		g.Go(func() error { return si.pg.runListener(ctx) })
+	}
+
+	if !s.passiveMode {
+		if s.methods["arp"] {
+			g.Go(func() error { return s.runSweeps(ctx) })
+		}
+
+		for _, si := range s.intfs {
+			si := si
+
+			// continuously poll mdns in order to detect changes or skipped hosts
+			if !s.once && s.methods["mdns"] {
+				g.Go(func() error { return si.mm.runPeriodicRequests(ctx) })
+			}
+
+			if s.dhcpProbe {
+				g.Go(func() error { return si.md.runPeriodicRequests(ctx) })
+			}
+		}
+
+		g.Go(func() error { return s.dnsProbes.run(ctx) })
+		g.Go(func() error { return s.mdnsProbes.run(ctx) })
+		g.Go(func() error { return s.nbnsProbes.run(ctx) })
+	}
+
+	g.Go(func() error { return s.runNodes(ctx) })
+
+	err := g.Wait()
+
+	if errors.Is(err, errScanComplete) {
+		s.complete.Store(true)
+		return nil
+	}
+
+	// senders can fail after the socket has been closed
+	if parentCtx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// runSweeps runs the ARP sweeps of every interface.
+// In once mode, it returns errScanComplete when all of them are complete.
+func (s *Scanner) runSweeps(ctx context.Context) error {
+	var g errgroup.Group
+
+	for _, si := range s.intfs {
+		si := si
+		g.Go(func() error { return si.ma.runPeriodicRequests(ctx) })
+	}
+
+	err := g.Wait()
+	if err != nil || !s.once || ctx.Err() != nil {
+		return err
+	}
+
+	// wait for replies to the last requests and for name probes
+	if !sleep(ctx, s.gracePeriod) {
+		return nil
+	}
+	return errScanComplete
+}
+
+func (s *Scanner) runNodes(ctx context.Context) error {
+	nodes := make(map[nodeKey]*Node)
+	dhcpServers := make(map[nodeKey]*DHCPServer)
+	var alerts []Alert
+
+	emit := func(typ EventType, n *Node, prev *Node) {
+		if s.onEvent != nil {
+			s.onEvent(Event{Type: typ, Node: *n, Previous: prev})
+		}
+	}
+
+	raise := func(si *scanIntf, vlan uint16, a Alert, n *Node) {
+		a.Interface = si.intf.Name
+		a.VLAN = vlan
+		alerts = append(alerts, a)
+		if len(alerts) > maxAlerts {
+			alerts = alerts[1:]
+		}
+		s.stats.alerts.Add(1)
+
+		if s.onEvent != nil {
+			s.onEvent(Event{Type: EventAlert, Node: *n, Alert: &a})
+		}
+	}
+
+	addNode := func(si *scanIntf, key nodeKey, n *Node) {
+		n.FirstSeen = time.Now()
+		n.LastSeen = n.FirstSeen
+		n.Online = true
+		n.Sightings = 1
+		n.Interface = si.intf.Name
+		n.VLAN = key.vlan
+		n.Gateway = key.vlan == 0 && si.gatewayIP != nil && si.gatewayIP.Equal(n.IP)
+		nodes[key] = n
+		s.stats.newNodes.Add(1)
+
+		// find the most recent node with the same MAC on the same interface and VLAN
+		var prev *Node
+		for _, n2 := range nodes {
+			if n2 != n && bytes.Equal(n2.MAC, n.MAC) &&
+				n2.Interface == n.Interface && n2.VLAN == n.VLAN &&
+				(prev == nil || n2.LastSeen.After(prev.LastSeen)) {
+				prev = n2
+			}
+		}
+
+		if prev != nil {
+			prevCopy := *prev
+			emit(EventIPChange, n, &prevCopy)
+		} else {
+			emit(EventNew, n, nil)
+		}
+	}
+
+	touchNode := func(n *Node) {
+		n.LastSeen = time.Now()
+		n.Sightings++
+		if !n.Online {
+			n.Online = true
+			emit(EventOnline, n, nil)
+		}
+	}
+
+	offlineCheck := time.NewTicker(offlineCheckPeriod)
+	defer offlineCheck.Stop()
+
+	probeCheck := time.NewTicker(s.probes.checkPeriod())
+	defer probeCheck.Stop()
+
+	for {
+		select {
+		case req := <-s.arp:
+			key := req.si.nodeKey(req.vlan, req.srcMac, req.srcIP)
+
+			if _, ok := nodes[key]; !ok {
+				n := &Node{
+					MAC:    req.srcMac,
+					IP:     req.srcIP,
+					Method: "arp",
+				}
+				addNode(req.si, key, n)
+
+				if !s.passiveMode {
+					s.probes.start(key, n)
+				}
+
+				// update last seen
+			} else {
+				touchNode(nodes[key])
+			}
+
+			for _, a := range req.si.watch(req.vlan).observe(req, time.Now()) {
+				raise(req.si, req.vlan, a, nodes[key])
+			}
+
+		case req := <-s.dns:
+			n := nodes[req.key]
+			answered(n, "dns")
+			if req.dns != "" && n.DNS != req.dns {
+				prev := *n
+				n.DNS = req.dns
+				emit(EventUpdate, n, &prev)
+			}
+
+		case req := <-s.mdns:
+			key := req.si.nodeKey(req.vlan, req.srcMac, req.srcIP)
+
+			if _, ok := nodes[key]; !ok {
+				addNode(req.si, key, &Node{
+					MAC:      req.srcMac,
+					IP:       req.srcIP,
+					MDNS:     req.domainName,
+					Method:   "mdns",
+					Services: req.services,
+				})
+			} else {
+				n := nodes[key]
+				touchNode(n)
+				n.Services = mergeServices(n.Services, req.services)
+
+				// service announcements do not contain the name
+				if req.domainName != "" {
+					answered(n, "mdns")
+					if n.MDNS != req.domainName {
+						prev := *n
+						n.MDNS = req.domainName
+						emit(EventUpdate, n, &prev)
+					}
+				}
+			}
+
+		case req := <-s.nbns:
+			key := req.si.nodeKey(req.vlan, req.srcMac, req.srcIP)
+
+			if _, has := nodes[key]; !has {
+				addNode(req.si, key, &Node{
+					MAC:    req.srcMac,
+					IP:     req.srcIP,
+					NBNS:   req.name,
+					Method: "nbns",
+					TTL:    req.ttl,
+				})
+			} else {
+				n := nodes[key]
+				touchNode(n)
+				n.TTL = req.ttl
+
+				// other replies are not addressed to us, or are replies to previous attempts
+				if req.txid == n.Probes.NBNS.txid {
+					answered(n, "nbns")
+				}
+
+				if n.NBNS != req.name {
+					prev := *n
+					n.NBNS = req.name
+					emit(EventUpdate, n, &prev)
+				}
+			}
+
+		case req := <-s.dhcp:
+			srv := req.server
+			srv.LastSeen = time.Now()
+			srv.Interface = req.si.intf.Name
+			srv.VLAN = req.vlan
+			key := req.si.nodeKey(req.vlan, srv.MAC, srv.IP)
+
+			_, known := dhcpServers[key]
+			srv.Allowed = dhcpAllowed(s.allowedDHCP, srv)
+			dhcpServers[key] = &srv
+
+			if !known && !srv.Allowed {
+				raise(req.si, req.vlan, Alert{
+					Time:    srv.LastSeen,
+					Kind:    AlertRogueDHCP,
+					Message: fmt.Sprintf("rogue DHCP server %s (%s)", srv.IP, srv.MAC),
+					IP:      srv.IP,
+					MACs:    []net.HardwareAddr{srv.MAC},
+				}, &Node{
+					LastSeen:  srv.LastSeen,
+					Online:    true,
+					MAC:       srv.MAC,
+					IP:        srv.IP,
+					Interface: srv.Interface,
+					VLAN:      srv.VLAN,
+				})
+			}
+
+		case req := <-s.probeSent:
+			if n, ok := nodes[req.key]; ok {
+				s.probes.sent(n, req)
+			}
+
+		case <-offlineCheck.C:
+			now := time.Now()
+			for _, n := range nodes {
+				if n.Online && now.Sub(n.LastSeen) >= s.offlineTimeout {
+					n.Online = false
+					emit(EventOffline, n, nil)
+				}
+			}
+
+		case <-probeCheck.C:
+			now := time.Now()
+			for key, n := range nodes {
+				s.probes.check(key, n, now)
+			}
+
+		case req := <-s.getNodes:
+			ret := make([]Node, 0, len(nodes))
+			for _, n := range nodes {
+				ret = append(ret, *n)
+			}
+			req.res <- ret
+
+		case req := <-s.getDHCPServers:
+			ret := make([]DHCPServer, 0, len(dhcpServers))
+			for _, srv := range dhcpServers {
+				ret = append(ret, *srv)
+			}
+			req.res <- ret
+
+		case req := <-s.getAlerts:
+			req.res <- append([]Alert(nil), alerts...)
+
+		case req := <-s.reprobe:
+			n, ok := nodes[req.key]
+			if !ok {
+				req.res <- fmt.Errorf("node not found")
+				break
+			}
+
+			n.Probes = NodeProbes{}
+			s.probes.start(req.key, n)
+			req.res <- nil
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,1045 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	testOwnMac = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	testOwnIP  = net.IP{192, 168, 1, 10}
+)
+
+type testHost struct {
+	mac  net.HardwareAddr
+	ip   net.IP
+	mdns string
+	nbns string
+}
+
+var testLAN = []testHost{
+	{
+		mac:  net.HardwareAddr{0x00, 0x11, 0x32, 0x00, 0x00, 0x20},
+		ip:   net.IP{192, 168, 1, 20},
+		mdns: "nas",
+	},
+	{
+		mac:  net.HardwareAddr{0x00, 0x1b, 0x21, 0x00, 0x00, 0x30},
+		ip:   net.IP{192, 168, 1, 30},
+		nbns: "DESKTOP-1",
+	},
+	{
+		mac: net.HardwareAddr{0x00, 0x1b, 0x21, 0x00, 0x00, 0x40},
+		ip:  net.IP{192, 168, 1, 40},
+	},
+}
+
+func serializeFrame(t *testing.T, ls ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+	err := gopacket.SerializeLayers(buf, opts, ls...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func arpReplyFrame(t *testing.T, h testHost) []byte {
+	eth := layers.Ethernet{
+		SrcMAC:       h.mac,
+		DstMAC:       testOwnMac,
+		EthernetType: layers.EthernetTypeARP,
+	}
+	arp := layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPReply,
+		SourceHwAddress:   h.mac,
+		SourceProtAddress: h.ip,
+		DstHwAddress:      testOwnMac,
+		DstProtAddress:    testOwnIP,
+	}
+	return serializeFrame(t, &eth, &arp)
+}
+
+func udpFrame(t *testing.T, h testHost, dstMac net.HardwareAddr, dstIP net.IP,
+	port layers.UDPPort, payload gopacket.SerializableLayer,
+) []byte {
+	eth := layers.Ethernet{
+		SrcMAC:       h.mac,
+		DstMAC:       dstMac,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    h.ip,
+		DstIP:    dstIP,
+	}
+	udp := layers.UDP{
+		SrcPort: port,
+		DstPort: port,
+	}
+	err := udp.SetNetworkLayerForChecksum(&ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serializeFrame(t, &eth, &ip, &udp, payload)
+}
+
+func mdnsAnswerFrame(t *testing.T, h testHost, answerIP net.IP) []byte {
+	return udpFrame(t, h, net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0xfb}, net.IP{224, 0, 0, 251},
+		mdnsPort, &LayerMdns{
+			IsResponse: true,
+			Answers: []MdnsAnswer{{
+				Query: fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa",
+					answerIP[3], answerIP[2], answerIP[1], answerIP[0]),
+				Type:       12, // PTR
+				Class:      1,  // IN
+				TTL:        120,
+				DomainName: h.mdns + ".local",
+			}},
+		})
+}
+
+func nbnsAnswerFrame(t *testing.T, h testHost, txid uint16) []byte {
+	return udpFrame(t, h, testOwnMac, testOwnIP, nbnsPort, &LayerNbns{
+		TransactionID: txid,
+		IsResponse:    true,
+		Answers: []NbnsAnswer{{
+			Query: "CKAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+			Type:  0x21, // NB_STAT
+			Class: 1,    // IN
+			Names: []NbnsAnswerName{
+				{Name: "WORKGROUP", Type: 0x00},
+				{Name: h.nbns, Type: 0x20},
+			},
+		}},
+	})
+}
+
+// newTestScanner starts a Scanner bound to a fakePacketConn.
+// The returned function stops the scanner and checks that it shut down cleanly.
+func newTestScanner(t *testing.T, opts Options) (*Scanner, *fakePacketConn, func()) {
+	conn := newFakePacketConn()
+
+	s, stop := startTestScanner(t, opts, []boundSocket{{
+		intf: &net.Interface{
+			Index:        1,
+			Name:         "fake0",
+			HardwareAddr: testOwnMac,
+			Flags:        net.FlagUp | net.FlagBroadcast,
+		},
+		ownIP:   testOwnIP,
+		gateway: opts.Gateway,
+		socket:  conn,
+	}})
+
+	return s, conn, stop
+}
+
+// startTestScanner starts a Scanner bound to the given sockets, that must be fakePacketConns.
+func startTestScanner(t *testing.T, opts Options, bound []boundSocket) (*Scanner, func()) {
+	s, err := newScanner(opts, bound)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.lookupAddr = func(_ context.Context, addr string) ([]string, error) {
+		return []string{"host-" + addr + ".lan."}, nil
+	}
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	runErr := make(chan error)
+	go func() {
+		runErr <- s.Run(ctx)
+	}()
+
+	stop := func() {
+		ctxCancel()
+
+		select {
+		case err := <-runErr:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("scanner did not stop")
+		}
+
+		for _, b := range bound {
+			select {
+			case <-b.socket.(*fakePacketConn).closed:
+			default:
+				t.Errorf("socket of %s was not closed", b.intf.Name)
+			}
+		}
+
+		if s.Nodes() != nil {
+			t.Error("Nodes() returned data after Run() returned")
+		}
+	}
+
+	return s, stop
+}
+
+func scannerNodes(s *Scanner) map[nodeKey]Node {
+	ret := make(map[nodeKey]Node)
+	for _, n := range s.Nodes() {
+		key := newNodeKey(n.MAC, n.IP)
+		key.vlan = n.VLAN
+		ret[key] = n
+	}
+	return ret
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPassiveDiscovery(t *testing.T) {
+	s, conn, stop := newTestScanner(t, Options{Passive: true})
+	defer stop()
+
+	for _, h := range testLAN {
+		conn.inject(arpReplyFrame(t, h))
+	}
+	conn.inject(mdnsAnswerFrame(t, testLAN[0], testLAN[0].ip))
+	conn.inject(nbnsAnswerFrame(t, testLAN[1], 0))
+
+	// an mDNS answer about an IP that is not the sender must be ignored
+	conn.inject(mdnsAnswerFrame(t, testHost{
+		mac:  testLAN[2].mac,
+		ip:   testLAN[2].ip,
+		mdns: "spoofed",
+	}, testLAN[0].ip))
+
+	waitFor(t, "node table", func() bool {
+		nodes := scannerNodes(s)
+		return len(nodes) == 3 &&
+			nodes[newNodeKey(testLAN[0].mac, testLAN[0].ip)].MDNS != "" &&
+			nodes[newNodeKey(testLAN[1].mac, testLAN[1].ip)].NBNS != ""
+	})
+
+	nodes := scannerNodes(s)
+
+	for _, h := range testLAN {
+		n, ok := nodes[newNodeKey(h.mac, h.ip)]
+		if !ok {
+			t.Fatalf("node %s %s not found", h.mac, h.ip)
+		}
+		if !bytes.Equal(n.MAC, h.mac) || !n.IP.Equal(h.ip) {
+			t.Errorf("unexpected node address: %s %s", n.MAC, n.IP)
+		}
+		if n.MDNS != h.mdns {
+			t.Errorf("node %s: expected mdns %q, got %q", h.ip, h.mdns, n.MDNS)
+		}
+		if n.NBNS != h.nbns {
+			t.Errorf("node %s: expected nbns %q, got %q", h.ip, h.nbns, n.NBNS)
+		}
+		if n.DNS != "" {
+			t.Errorf("node %s: unexpected dns %q", h.ip, n.DNS)
+		}
+	}
+
+	if w := conn.writtenFrames(); len(w) != 0 {
+		t.Errorf("passive mode wrote %d frames", len(w))
+	}
+
+	st := s.Stats()
+	if st.NewNodes != 3 {
+		t.Errorf("expected 3 new nodes, got %d", st.NewNodes)
+	}
+	if st.FramesReceived != 6 {
+		t.Errorf("expected 6 frames, got %d", st.FramesReceived)
+	}
+	if v := st.Methods["arp"].Responses; v != 3 {
+		t.Errorf("expected 3 ARP responses, got %d", v)
+	}
+	if v := st.Methods["nbns"].Responses; v != 1 {
+		t.Errorf("expected 1 NBNS response, got %d", v)
+	}
+}
+
+func TestNodeDetails(t *testing.T) {
+	s, conn, stop := newTestScanner(t, Options{Passive: true})
+	defer stop()
+
+	h := testLAN[1]
+	key := newNodeKey(h.mac, h.ip)
+
+	conn.inject(arpReplyFrame(t, h))
+	waitFor(t, "node", func() bool {
+		_, ok := scannerNodes(s)[key]
+		return ok
+	})
+
+	conn.inject(arpReplyFrame(t, h))
+	conn.inject(nbnsAnswerFrame(t, h, 0))
+
+	// a DNS-SD announcement, that does not contain the name of the node
+	conn.inject(udpFrame(t, h, net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0xfb}, net.IP{224, 0, 0, 251},
+		mdnsPort, &LayerMdns{
+			IsResponse: true,
+			Answers: []MdnsAnswer{
+				{
+					Query:      "_services._dns-sd._udp.local",
+					Type:       12, // PTR
+					Class:      1,  // IN
+					TTL:        4500,
+					DomainName: "_ipp._tcp.local",
+				},
+				{
+					Query:      "_http._tcp.local",
+					Type:       12, // PTR
+					Class:      1,  // IN
+					TTL:        4500,
+					DomainName: "Printer._http._tcp.local",
+				},
+			},
+		}))
+
+	waitFor(t, "node details", func() bool {
+		n := scannerNodes(s)[key]
+		return len(n.Services) != 0 && n.NBNS != "" && n.Sightings == 4
+	})
+
+	n := scannerNodes(s)[key]
+
+	if n.Method != "arp" {
+		t.Errorf("unexpected method %q", n.Method)
+	}
+	if n.Sightings != 4 {
+		t.Errorf("expected 4 sightings, got %d", n.Sightings)
+	}
+	if n.FirstSeen.IsZero() || n.LastSeen.Before(n.FirstSeen) {
+		t.Errorf("unexpected times: first seen %v, last seen %v", n.FirstSeen, n.LastSeen)
+	}
+	if n.TTL != 64 {
+		t.Errorf("expected TTL 64, got %d", n.TTL)
+	}
+	if !slices.Equal(n.Services, []string{"_http._tcp", "_ipp._tcp"}) {
+		t.Errorf("unexpected services %v", n.Services)
+	}
+	if n.MDNS != "" {
+		t.Errorf("unexpected mdns %q", n.MDNS)
+	}
+}
+
+func TestActiveDiscovery(t *testing.T) {
+	s, conn, stop := newTestScanner(t, Options{})
+	defer stop()
+
+	// the ARP sweep starts immediately
+	waitFor(t, "ARP request", func() bool {
+		for _, byts := range conn.writtenFrames() {
+			pkt := gopacket.NewPacket(byts, layers.LayerTypeEthernet, gopacket.Default)
+			if arp, ok := pkt.Layer(layers.LayerTypeARP).(*layers.ARP); ok &&
+				arp.Operation == layers.ARPRequest &&
+				bytes.Equal(arp.SourceHwAddress, testOwnMac) &&
+				bytes.Equal(arp.SourceProtAddress, testOwnIP) {
+				return true
+			}
+		}
+		return false
+	})
+
+	h := testLAN[1]
+	conn.inject(arpReplyFrame(t, h))
+
+	// a new node triggers a NBNS query sent directly to it
+	waitFor(t, "NBNS query", func() bool {
+		for _, byts := range conn.writtenFrames() {
+			pkt := gopacket.NewPacket(byts, layers.LayerTypeEthernet, gopacket.Default)
+			eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+			if !ok || !bytes.Equal(eth.DstMAC, h.mac) {
+				continue
+			}
+			if udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP); ok &&
+				udp.DstPort == nbnsPort {
+				return true
+			}
+		}
+		return false
+	})
+
+	conn.inject(nbnsAnswerFrame(t, h, 0))
+
+	key := newNodeKey(h.mac, h.ip)
+	waitFor(t, "node names", func() bool {
+		n := scannerNodes(s)[key]
+		return n.NBNS != "" && n.DNS != ""
+	})
+
+	n := scannerNodes(s)[key]
+	if n.NBNS != h.nbns {
+		t.Errorf("expected nbns %q, got %q", h.nbns, n.NBNS)
+	}
+	if n.DNS != "host-192.168.1.30.lan" {
+		t.Errorf("unexpected dns %q", n.DNS)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	s, conn, stop := newTestScanner(t, Options{
+		ProbeTimeout:  50 * time.Millisecond,
+		ProbeAttempts: 2,
+	})
+	defer stop()
+
+	h := testLAN[1]
+	key := newNodeKey(h.mac, h.ip)
+	conn.inject(arpReplyFrame(t, h))
+
+	nbnsQueries := func() []uint16 {
+		var ret []uint16
+		for _, byts := range conn.writtenFrames() {
+			pkt := gopacket.NewPacket(byts, layers.LayerTypeEthernet, gopacket.Default)
+			eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+			if !ok || !bytes.Equal(eth.DstMAC, h.mac) {
+				continue
+			}
+			if udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP); ok &&
+				udp.DstPort == nbnsPort && len(udp.Payload) >= 2 {
+				ret = append(ret, uint16(udp.Payload[0])<<8|uint16(udp.Payload[1]))
+			}
+		}
+		return ret
+	}
+
+	// unanswered requests are sent again, then marked as unanswered
+	waitFor(t, "unanswered probes", func() bool {
+		n := scannerNodes(s)[key]
+		return n.Probes.NBNS.State == ProbeNoResponse && n.Probes.MDNS.State == ProbeNoResponse
+	})
+
+	n := scannerNodes(s)[key]
+	if n.Probes.DNS.State != ProbeAnswered || n.Probes.DNS.Attempts != 1 {
+		t.Errorf("unexpected DNS probe: %+v", n.Probes.DNS)
+	}
+	if n.Probes.NBNS.Attempts != 2 || n.Probes.MDNS.Attempts != 2 {
+		t.Errorf("unexpected attempts: %+v", n.Probes)
+	}
+
+	txids := nbnsQueries()
+	if len(txids) != 2 || txids[0] == txids[1] {
+		t.Fatalf("unexpected NBNS queries: %v", txids)
+	}
+
+	// a reply with another transaction ID does not match the request
+	conn.inject(nbnsAnswerFrame(t, h, txids[1]+1))
+	waitFor(t, "NBNS name", func() bool {
+		return scannerNodes(s)[key].NBNS != ""
+	})
+	if st := scannerNodes(s)[key].Probes.NBNS.State; st != ProbeNoResponse {
+		t.Errorf("unexpected NBNS state: %v", st)
+	}
+
+	conn.inject(nbnsAnswerFrame(t, h, txids[1]))
+	waitFor(t, "NBNS reply", func() bool {
+		return scannerNodes(s)[key].Probes.NBNS.State == ProbeAnswered
+	})
+}
+
+func TestClose(t *testing.T) {
+	conn := newFakePacketConn()
+
+	s, err := newScanner(Options{}, []boundSocket{{
+		intf:   &net.Interface{Index: 1, Name: "fake0", HardwareAddr: testOwnMac},
+		ownIP:  testOwnIP,
+		socket: conn,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+
+	select {
+	case <-conn.closed:
+	default:
+		t.Error("socket was not closed")
+	}
+}
+
+func TestReprobeAndPing(t *testing.T) {
+	s, conn, stop := newTestScanner(t, Options{
+		Methods:       []string{"arp", "nbns"},
+		ProbeTimeout:  50 * time.Millisecond,
+		ProbeAttempts: 1,
+	})
+	defer stop()
+
+	h := testLAN[1]
+	key := newNodeKey(h.mac, h.ip)
+	conn.inject(arpReplyFrame(t, h))
+
+	waitFor(t, "unanswered probe", func() bool {
+		return scannerNodes(s)[key].Probes.NBNS.State == ProbeNoResponse
+	})
+
+	// frames sent to the node, by type
+	sent := func() (arps int, echos []*layers.ICMPv4) {
+		for _, byts := range conn.writtenFrames() {
+			pkt := gopacket.NewPacket(byts, layers.LayerTypeEthernet, gopacket.Default)
+			eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+			if !ok || !bytes.Equal(eth.DstMAC, h.mac) {
+				continue
+			}
+			if pkt.Layer(layers.LayerTypeARP) != nil {
+				arps++
+			}
+			if icmp, ok := pkt.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok {
+				echos = append(echos, icmp)
+			}
+		}
+		return
+	}
+
+	err := s.Reprobe(context.Background(), scannerNodes(s)[key])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "new probe", func() bool {
+		return scannerNodes(s)[key].Probes.NBNS.Attempts == 1 &&
+			scannerNodes(s)[key].Probes.NBNS.State == ProbeNoResponse
+	})
+	if arps, _ := sent(); arps != 1 {
+		t.Errorf("expected 1 ARP request, got %d", arps)
+	}
+
+	err = s.Reprobe(context.Background(), Node{MAC: h.mac, IP: testLAN[2].ip, Interface: "fake0"})
+	if err == nil {
+		t.Errorf("unknown node reprobed")
+	}
+
+	type pingRes struct {
+		rtt time.Duration
+		err error
+	}
+	res := make(chan pingRes)
+	go func() {
+		rtt, err := s.Ping(context.Background(), scannerNodes(s)[key])
+		res <- pingRes{rtt, err}
+	}()
+
+	var echo *layers.ICMPv4
+	waitFor(t, "echo request", func() bool {
+		_, echos := sent()
+		if len(echos) == 0 {
+			return false
+		}
+		echo = echos[0]
+		return true
+	})
+
+	eth := layers.Ethernet{
+		SrcMAC:       h.mac,
+		DstMAC:       testOwnMac,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolICMPv4,
+		SrcIP:    h.ip,
+		DstIP:    testOwnIP,
+	}
+	icmp := layers.ICMPv4{
+		TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0),
+		Id:       echo.Id,
+		Seq:      echo.Seq,
+	}
+	conn.inject(serializeFrame(t, &eth, &ip, &icmp, gopacket.Payload(echo.Payload)))
+
+	r := <-res
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.rtt <= 0 {
+		t.Errorf("unexpected round-trip time %v", r.rtt)
+	}
+
+	// the reply is waited for the probe timeout
+	_, err = s.Ping(context.Background(), scannerNodes(s)[key])
+	if err == nil {
+		t.Errorf("ping without reply succeeded")
+	}
+}
+
+func TestReprobeRate(t *testing.T) {
+	s, conn, stop := newTestScanner(t, Options{
+		Methods: []string{"arp"},
+		Rates:   map[string]Rate{"arp": {PacketsPerSecond: 0.1, Burst: 1}},
+	})
+	defer stop()
+
+	h := testLAN[1]
+	conn.inject(arpReplyFrame(t, h))
+
+	waitFor(t, "node", func() bool {
+		return len(s.Nodes()) == 1
+	})
+
+	// the only token has been taken by the sweep
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := s.Reprobe(ctx, s.Nodes()[0])
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, byts := range conn.writtenFrames() {
+		pkt := gopacket.NewPacket(byts, layers.LayerTypeEthernet, gopacket.Default)
+		if eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok && bytes.Equal(eth.DstMAC, h.mac) {
+			t.Errorf("ARP request sent over the rate limit")
+		}
+	}
+}
+
+func TestMultipleInterfaces(t *testing.T) {
+	conn0 := newFakePacketConn()
+	conn1 := newFakePacketConn()
+
+	s, stop := startTestScanner(t, Options{Passive: true}, []boundSocket{
+		{
+			intf: &net.Interface{
+				Index:        1,
+				Name:         "fake0",
+				HardwareAddr: testOwnMac,
+				Flags:        net.FlagUp | net.FlagBroadcast,
+			},
+			ownIP:  testOwnIP,
+			socket: conn0,
+		},
+		{
+			intf: &net.Interface{
+				Index:        2,
+				Name:         "fake1",
+				HardwareAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02},
+				Flags:        net.FlagUp | net.FlagBroadcast,
+			},
+			ownIP:   net.IP{10, 0, 0, 10},
+			gateway: net.IP{10, 0, 0, 1},
+			socket:  conn1,
+		},
+	})
+	defer stop()
+
+	infos := s.Interfaces()
+	if len(infos) != 2 || infos[1].Name != "fake1" || !infos[1].Gateway.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("unexpected interfaces: %+v", infos)
+	}
+
+	gateway := testHost{
+		mac: net.HardwareAddr{0x00, 0x11, 0x32, 0x00, 0x00, 0x01},
+		ip:  net.IP{10, 0, 0, 1},
+	}
+
+	// the same host is seen on both segments
+	conn0.inject(arpReplyFrame(t, testLAN[0]))
+	conn1.inject(arpReplyFrame(t, testLAN[0]))
+	conn1.inject(arpReplyFrame(t, gateway))
+
+	waitFor(t, "node table", func() bool {
+		return len(s.Nodes()) == 3
+	})
+
+	perIntf := make(map[string]int)
+	for _, n := range s.Nodes() {
+		perIntf[n.Interface]++
+
+		if n.Gateway != (n.Interface == "fake1" && n.IP.Equal(gateway.ip)) {
+			t.Errorf("unexpected gateway flag: %+v", n)
+		}
+	}
+	if perIntf["fake0"] != 1 || perIntf["fake1"] != 2 {
+		t.Errorf("unexpected nodes per interface: %v", perIntf)
+	}
+}
+
+// taggedFrame adds a 802.1Q tag to a frame.
+func taggedFrame(frame []byte, vlan uint16) []byte {
+	return insertVLANTag(append(make([]byte, 4), frame...), vlan, 0x8100)
+}
+
+func TestVLAN(t *testing.T) {
+	_, ownRange, _ := net.ParseCIDR("192.168.1.8/30")
+	_, vlanRange, _ := net.ParseCIDR("10.10.0.0/30")
+
+	s, conn, stop := newTestScanner(t, Options{
+		Ranges: []*net.IPNet{ownRange},
+		VLANs:  []VLAN{{ID: 10, Ranges: []*net.IPNet{vlanRange}}},
+	})
+	defer stop()
+
+	// tagged ARP probes are sent with a zero sender IP
+	waitFor(t, "tagged ARP request", func() bool {
+		for _, byts := range conn.writtenFrames() {
+			pkt := gopacket.NewPacket(byts, layers.LayerTypeEthernet, gopacket.Default)
+			dot1q, ok := pkt.Layer(layers.LayerTypeDot1Q).(*layers.Dot1Q)
+			if !ok || dot1q.VLANIdentifier != 10 {
+				continue
+			}
+			if arp, ok := pkt.Layer(layers.LayerTypeARP).(*layers.ARP); ok &&
+				bytes.Equal(arp.SourceProtAddress, []byte{0, 0, 0, 0}) &&
+				vlanRange.Contains(arp.DstProtAddress) {
+				return true
+			}
+		}
+		return false
+	})
+
+	// the same IP is used on the untagged network and on the VLAN
+	h := testLAN[1]
+	conn.inject(arpReplyFrame(t, h))
+	conn.inject(taggedFrame(arpReplyFrame(t, h), 10))
+
+	vh := testLAN[0]
+	conn.inject(taggedFrame(mdnsAnswerFrame(t, vh, vh.ip), 20))
+
+	waitFor(t, "node table", func() bool {
+		return len(s.Nodes()) == 3
+	})
+
+	nodes := scannerNodes(s)
+
+	if n := nodes[newNodeKey(h.mac, h.ip)]; n.VLAN != 0 {
+		t.Errorf("unexpected untagged node: %+v", n)
+	}
+
+	key := newNodeKey(h.mac, h.ip)
+	key.vlan = 10
+	n, ok := nodes[key]
+	if !ok || n.VLAN != 10 {
+		t.Fatalf("tagged node not found")
+	}
+	if n.Probes.NBNS.State != ProbeNone || n.Probes.MDNS.State == ProbeNone {
+		t.Errorf("unexpected probes: %+v", n.Probes)
+	}
+
+	key = newNodeKey(vh.mac, vh.ip)
+	key.vlan = 20
+	if n := nodes[key]; n.MDNS != vh.mdns || n.VLAN != 20 {
+		t.Errorf("unexpected mdns node: %+v", n)
+	}
+
+	// no alert is raised, since the IP is claimed on different VLANs
+	if alerts := s.Alerts(); len(alerts) != 0 {
+		t.Errorf("unexpected alerts: %+v", alerts)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	events := make(chan Event, 16)
+
+	_, conn, stop := newTestScanner(t, Options{
+		Passive:        true,
+		OfflineTimeout: 100 * time.Millisecond,
+		OnEvent: func(evt Event) {
+			events <- evt
+		},
+	})
+	defer stop()
+
+	waitEvent := func(typ EventType) Event {
+		select {
+		case evt := <-events:
+			if evt.Type != typ {
+				t.Fatalf("expected event %v, got %v", typ, evt.Type)
+			}
+			return evt
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %v", typ)
+		}
+		return Event{}
+	}
+
+	h := testLAN[0]
+	conn.inject(arpReplyFrame(t, h))
+	evt := waitEvent(EventNew)
+	if !evt.Node.IP.Equal(h.ip) || !evt.Node.Online {
+		t.Errorf("unexpected node: %+v", evt.Node)
+	}
+
+	conn.inject(mdnsAnswerFrame(t, h, h.ip))
+	evt = waitEvent(EventUpdate)
+	if evt.Node.MDNS != h.mdns || evt.Previous == nil || evt.Previous.MDNS != "" {
+		t.Errorf("unexpected update: %+v", evt)
+	}
+
+	moved := h
+	moved.ip = net.IP{192, 168, 1, 21}
+	conn.inject(arpReplyFrame(t, moved))
+	evt = waitEvent(EventIPChange)
+	if !evt.Node.IP.Equal(moved.ip) || evt.Previous == nil || !evt.Previous.IP.Equal(h.ip) {
+		t.Errorf("unexpected IP change: %+v", evt)
+	}
+
+	waitEvent(EventOffline)
+	waitEvent(EventOffline)
+
+	conn.inject(arpReplyFrame(t, moved))
+	evt = waitEvent(EventOnline)
+	if !evt.Node.IP.Equal(moved.ip) {
+		t.Errorf("unexpected node: %+v", evt.Node)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	events := make(chan Event, 16)
+
+	gateway := testHost{
+		mac: net.HardwareAddr{0x00, 0x11, 0x32, 0x00, 0x00, 0x01},
+		ip:  net.IP{192, 168, 1, 1},
+	}
+
+	s, conn, stop := newTestScanner(t, Options{
+		Passive: true,
+		Gateway: gateway.ip,
+		OnEvent: func(evt Event) {
+			if evt.Type == EventAlert {
+				events <- evt
+			}
+		},
+	})
+	defer stop()
+
+	waitAlert := func(kind AlertKind) Event {
+		select {
+		case evt := <-events:
+			if evt.Alert == nil || evt.Alert.Kind != kind {
+				t.Fatalf("expected alert %v, got %+v", kind, evt.Alert)
+			}
+			return evt
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for alert %v", kind)
+		}
+		return Event{}
+	}
+
+	conn.inject(arpReplyFrame(t, gateway))
+	conn.inject(arpReplyFrame(t, testLAN[0]))
+
+	spoofed := testLAN[0]
+	spoofed.mac = testLAN[2].mac
+	conn.inject(arpReplyFrame(t, spoofed))
+	evt := waitAlert(AlertIPConflict)
+	if !evt.Alert.IP.Equal(testLAN[0].ip) || len(evt.Alert.MACs) != 2 ||
+		!bytes.Equal(evt.Node.MAC, spoofed.mac) {
+		t.Errorf("unexpected alert: %+v", evt)
+	}
+
+	spoofed = gateway
+	spoofed.mac = testLAN[2].mac
+	conn.inject(arpReplyFrame(t, spoofed))
+	evt = waitAlert(AlertGatewayMACChange)
+	if !evt.Alert.IP.Equal(gateway.ip) || !evt.Node.Gateway {
+		t.Errorf("unexpected alert: %+v", evt)
+	}
+
+	// alerts are not repeated
+	conn.inject(arpReplyFrame(t, testLAN[0]))
+	waitFor(t, "alert list", func() bool {
+		return len(s.Alerts()) == 2
+	})
+	select {
+	case evt := <-events:
+		t.Errorf("unexpected alert: %+v", evt.Alert)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if v := s.Stats().Alerts; v != 2 {
+		t.Errorf("expected 2 alerts, got %d", v)
+	}
+}
+
+func dhcpOfferFrame(t *testing.T, h testHost) []byte {
+	eth := layers.Ethernet{
+		SrcMAC:       h.mac,
+		DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    h.ip,
+		DstIP:    net.IP{255, 255, 255, 255},
+	}
+	udp := layers.UDP{
+		SrcPort: dhcpServerPort,
+		DstPort: dhcpClientPort,
+	}
+	err := udp.SetNetworkLayerForChecksum(&ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dhcp := layers.DHCPv4{
+		Operation:    layers.DHCPOpReply,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          1234,
+		YourClientIP: net.IP{192, 168, 1, 100},
+		ClientHWAddr: testOwnMac,
+		Options: []layers.DHCPOption{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeOffer)}),
+			layers.NewDHCPOption(layers.DHCPOptServerID, h.ip),
+			layers.NewDHCPOption(layers.DHCPOptSubnetMask, []byte{255, 255, 255, 0}),
+			layers.NewDHCPOption(layers.DHCPOptRouter, h.ip),
+			layers.NewDHCPOption(layers.DHCPOptDNS, []byte{8, 8, 8, 8, 1, 1, 1, 1}),
+		},
+	}
+	return serializeFrame(t, &eth, &ip, &udp, &dhcp)
+}
+
+func TestRogueDHCP(t *testing.T) {
+	events := make(chan Event, 16)
+
+	s, conn, stop := newTestScanner(t, Options{
+		Passive:            true,
+		AllowedDHCPServers: []string{testLAN[0].mac.String()},
+		OnEvent: func(evt Event) {
+			if evt.Type == EventAlert {
+				events <- evt
+			}
+		},
+	})
+	defer stop()
+
+	conn.inject(dhcpOfferFrame(t, testLAN[0]))
+	conn.inject(dhcpOfferFrame(t, testLAN[1]))
+
+	select {
+	case evt := <-events:
+		if evt.Alert.Kind != AlertRogueDHCP || !evt.Alert.IP.Equal(testLAN[1].ip) {
+			t.Errorf("unexpected alert: %+v", evt.Alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for alert")
+	}
+
+	servers := s.DHCPServers()
+	if len(servers) != 2 {
+		t.Fatalf("expected 2 DHCP servers, got %d", len(servers))
+	}
+
+	for _, srv := range servers {
+		allowed := bytes.Equal(srv.MAC, testLAN[0].mac)
+		if srv.Allowed != allowed {
+			t.Errorf("server %s: expected allowed %v", srv.MAC, allowed)
+		}
+		if srv.Subnet == nil || srv.Subnet.String() != "192.168.1.0/24" {
+			t.Errorf("unexpected subnet: %v", srv.Subnet)
+		}
+		if !srv.Gateway.Equal(srv.IP) || len(srv.DNS) != 2 || !srv.DNS[1].Equal(net.IP{1, 1, 1, 1}) {
+			t.Errorf("unexpected options: %+v", srv)
+		}
+	}
+}
+
+func TestOnce(t *testing.T) {
+	s, conn, stop := newTestScanner(t, Options{
+		Once:        true,
+		Retries:     1,
+		GracePeriod: 100 * time.Millisecond,
+		Rates:       map[string]Rate{"arp": {}},
+	})
+	defer stop()
+
+	conn.inject(arpReplyFrame(t, testLAN[0]))
+
+	// Run returns by itself
+	waitFor(t, "scan completion", func() bool {
+		return s.Nodes() == nil
+	})
+
+	if !s.Complete() {
+		t.Error("scan is not complete")
+	}
+
+	p := s.SweepProgress()
+	if p.Sweeps != 1 || p.Pass != 1 || p.Total != 252 || p.Sent != 252 {
+		t.Errorf("unexpected progress: %+v", p)
+	}
+
+	arps := 0
+	for _, byts := range conn.writtenFrames() {
+		pkt := gopacket.NewPacket(byts, layers.LayerTypeEthernet, gopacket.Default)
+		if pkt.Layer(layers.LayerTypeARP) != nil {
+			arps++
+		}
+	}
+	if arps != 253+252 {
+		t.Errorf("expected %d ARP requests, got %d", 253+252, arps)
+	}
+}
+
+func TestProbeRate(t *testing.T) {
+	start := time.Now()
+
+	s, conn, stop := newTestScanner(t, Options{
+		Methods:      []string{"arp", "mdns"},
+		Rates:        map[string]Rate{"arp": {}, "mdns": {PacketsPerSecond: 20, Burst: 1}},
+		ProbeTimeout: time.Minute,
+	})
+	defer stop()
+
+	for _, h := range testLAN {
+		conn.inject(arpReplyFrame(t, h))
+	}
+
+	// probes are sent while the mDNS sweep is running
+	waitFor(t, "mDNS probes", func() bool {
+		nodes := scannerNodes(s)
+		for _, h := range testLAN {
+			if nodes[newNodeKey(h.mac, h.ip)].Probes.MDNS.Attempts == 0 {
+				return false
+			}
+		}
+		return true
+	})
+
+	time.Sleep(300 * time.Millisecond)
+
+	count := 0
+	for _, byts := range conn.writtenFrames() {
+		pkt := gopacket.NewPacket(byts, layers.LayerTypeEthernet, gopacket.Default)
+		if udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP); ok && udp.DstPort == mdnsPort {
+			count++
+		}
+	}
+	elapsed := time.Since(start)
+
+	// sweeps and probes share the same limit
+	if limit := 1 + int(20*elapsed.Seconds()); count > limit {
+		t.Errorf("%d mDNS requests sent in %v, expected at most %d", count, elapsed, limit)
+	}
+	if count <= len(testLAN) {
+		t.Errorf("mDNS sweep was not running: %d requests", count)
+	}
+}
@@ -0,0 +1,106 @@
+package discover
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+)
+
+// MethodStats are the statistics of a discovery method.
+type MethodStats struct {
+	// ProbesSent is the number of requests sent.
+	ProbesSent uint64
+
+	// Responses is the number of valid responses received.
+	Responses uint64
+
+	// ParseErrors is the number of frames that could not be decoded.
+	ParseErrors uint64
+}
+
+// Stats are the statistics of a Scanner.
+type Stats struct {
+	// NewNodes is the number of nodes found since the start.
+	NewNodes uint64
+
+	// Alerts is the number of alerts raised since the start.
+	Alerts uint64
+
+	// FramesReceived is the number of frames read from the interface.
+	FramesReceived uint64
+
+	// ListenerDrops is the number of frames dropped by the kernel
+	// because the listener was not fast enough.
+	ListenerDrops uint64
+
+	// Methods contains statistics of each method, indexed by method name
+	// ("arp", "mdns", "nbns", "dns", "dhcp").
+	Methods map[string]MethodStats
+}
+
+type methodStats struct {
+	probesSent  atomic.Uint64
+	responses   atomic.Uint64
+	parseErrors atomic.Uint64
+}
+
+func (ms *methodStats) snapshot() MethodStats {
+	return MethodStats{
+		ProbesSent:  ms.probesSent.Load(),
+		Responses:   ms.responses.Load(),
+		ParseErrors: ms.parseErrors.Load(),
+	}
+}
+
+type stats struct {
+	newNodes       atomic.Uint64
+	alerts         atomic.Uint64
+	framesReceived atomic.Uint64
+	arp            methodStats
+	mdns           methodStats
+	nbns           methodStats
+	dns            methodStats
+	dhcp           methodStats
+}
+
+// dropCounter is implemented by packetConns that can report kernel drops.
+type dropCounter interface {
+	Drops() (uint64, error)
+}
+
+// Stats returns a snapshot of the statistics.
+func (s *Scanner) Stats() Stats {
+	ret := Stats{
+		NewNodes:       s.stats.newNodes.Load(),
+		Alerts:         s.stats.alerts.Load(),
+		FramesReceived: s.stats.framesReceived.Load(),
+		Methods: map[string]MethodStats{
+			"arp":  s.stats.arp.snapshot(),
+			"mdns": s.stats.mdns.snapshot(),
+			"nbns": s.stats.nbns.snapshot(),
+			"dns":  s.stats.dns.snapshot(),
+			"dhcp": s.stats.dhcp.snapshot(),
+		},
+	}
+
+	for _, si := range s.intfs {
+		if dc, ok := si.ls.socket.(dropCounter); ok {
+			if v, err := dc.Drops(); err == nil {
+				ret.ListenerDrops += v
+			}
+		}
+	}
+
+	return ret
+}
+
+// isLayerDecodeError checks whether a DecodeLayers() error was caused
+// by the layer following prev, rather than by an unsupported layer.
+func isLayerDecodeError(err error, decoded []gopacket.LayerType, prev gopacket.LayerType) bool {
+	var unsupported gopacket.UnsupportedLayerType
+	if errors.As(err, &unsupported) {
+		return false
+	}
+	return len(decoded) != 0 && decoded[len(decoded)-1] == prev
+}
@@ -1,13 +1,18 @@
-package main
+package discover
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"net"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/macs"
 )
 
@@ -46,7 +51,8 @@ func defaultInterfaceName() (string, error) {
 	return "", fmt.Errorf("no interfaces found")
 }
 
-func macVendor(mac net.HardwareAddr) string {
+// MacVendor returns the vendor associated with a MAC address.
+func MacVendor(mac net.HardwareAddr) string {
 	var pref [3]byte
 	copy(pref[:], mac[:3])
 	if v, ok := macs.ValidMACPrefixMap[pref]; ok {
@@ -55,6 +61,18 @@ func macVendor(mac net.HardwareAddr) string {
 	return "unknown"
 }
 
+// sanitizeName makes a name received from the network safe to print.
+// Invalid UTF-8 sequences, control characters and bidirectional formatting
+// characters, that could alter the terminal or reorder the text, are replaced.
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
 func copyMac(in net.HardwareAddr) net.HardwareAddr {
 	ret := net.HardwareAddr(make([]byte, 6))
 	copy(ret, in)
@@ -173,17 +191,35 @@ func randShuffle(n int, swap func(i, j int)) error {
 	return nil
 }
 
-func randAvailableIPs(ownIP net.IP) ([]net.IP, error) {
+// randAvailableIPs returns the host addresses of the ranges in random order.
+func randAvailableIPs(ranges []*net.IPNet, ownIP net.IP) ([]net.IP, error) {
 	var entries []net.IP
+	seen := make(map[uint32]struct{})
 
-	for i := byte(1); i <= 254; i++ {
-		eip := make([]byte, 4)
-		copy(eip, ownIP)
-		eip[3] = i
-		if bytes.Equal(eip, ownIP) { // skip own ip
-			continue
+	for _, r := range ranges {
+		ones, bits := r.Mask.Size()
+		first := binary.BigEndian.Uint32(r.IP.To4().Mask(r.Mask))
+		last := first | uint32(1<<(bits-ones)-1)
+
+		// skip network and broadcast addresses
+		if ones < 31 {
+			first++
+			last--
+		}
+
+		for v := uint64(first); v <= uint64(last); v++ {
+			if _, ok := seen[uint32(v)]; ok {
+				continue
+			}
+			seen[uint32(v)] = struct{}{}
+
+			eip := make(net.IP, 4)
+			binary.BigEndian.PutUint32(eip, uint32(v))
+			if bytes.Equal(eip, ownIP) { // skip own ip
+				continue
+			}
+			entries = append(entries, eip)
 		}
-		entries = append(entries, eip)
 	}
 
 	err := randShuffle(len(entries), func(i, j int) {
@@ -240,6 +276,28 @@ func dnsQueryDecode(data []byte, start int) (string, int) {
 	return string(read), (pos + 1 - start)
 }
 
+// dnsRecordEncode appends a resource record, in the format used by mDNS and NetBIOS.
+func dnsRecordEncode(b gopacket.SerializeBuffer, name string, typ uint16, class uint16,
+	ttl uint32, rdata []byte,
+) error {
+	enc := dnsQueryEncode(name)
+
+	data, err := b.AppendBytes(len(enc) + 10 + len(rdata))
+	if err != nil {
+		return err
+	}
+
+	copy(data[:len(enc)], enc)
+	data = data[len(enc):]
+	binary.BigEndian.PutUint16(data[0:2], typ)
+	binary.BigEndian.PutUint16(data[2:4], class)
+	binary.BigEndian.PutUint32(data[4:8], ttl)
+	binary.BigEndian.PutUint16(data[8:10], uint16(len(rdata)))
+	copy(data[10:], rdata)
+
+	return nil
+}
+
 func dnsQueryEncode(in string) []byte {
 	tmp := strings.Split(in, ".")
 
@@ -266,3 +324,16 @@ func dnsQueryEncode(in string) []byte {
 
 	return ret
 }
+
+// sleep waits for the given duration. It returns false if the context is canceled before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
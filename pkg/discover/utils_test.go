@@ -0,0 +1,117 @@
+package discover
+
+import (
+	"net"
+	"sort"
+	"testing"
+)
+
+func TestRandAvailableIPs(t *testing.T) {
+	mustParseCIDR := func(v string) *net.IPNet {
+		_, ipnet, err := net.ParseCIDR(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ipnet
+	}
+
+	for _, ca := range []struct {
+		name   string
+		ranges []*net.IPNet
+		count  int
+		first  string
+		last   string
+	}{
+		{
+			"subnet",
+			[]*net.IPNet{mustParseCIDR("192.168.1.0/24")},
+			253,
+			"192.168.1.1",
+			"192.168.1.254",
+		},
+		{
+			"overlapping ranges",
+			[]*net.IPNet{mustParseCIDR("192.168.0.0/23"), mustParseCIDR("192.168.1.128/25")},
+			509,
+			"192.168.0.1",
+			"192.168.1.254",
+		},
+		{
+			"point to point",
+			[]*net.IPNet{mustParseCIDR("192.168.2.0/31")},
+			2,
+			"192.168.2.0",
+			"192.168.2.1",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			ips, err := randAvailableIPs(ca.ranges, testOwnIP)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(ips) != ca.count {
+				t.Fatalf("expected %d IPs, got %d", ca.count, len(ips))
+			}
+
+			sort.Slice(ips, func(i, j int) bool {
+				return ipToUint32(ips[i]) < ipToUint32(ips[j])
+			})
+			if ips[0].String() != ca.first || ips[len(ips)-1].String() != ca.last {
+				t.Errorf("unexpected bounds: %s - %s", ips[0], ips[len(ips)-1])
+			}
+
+			for _, ip := range ips {
+				if ip.Equal(testOwnIP) {
+					t.Errorf("own IP was returned")
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			"plain",
+			"Wohnzimmer-Fernseher",
+			"Wohnzimmer-Fernseher",
+		},
+		{
+			"non-ascii",
+			"Küche-電視",
+			"Küche-電視",
+		},
+		{
+			"control characters",
+			"evil\x1b[2Jname\r\n",
+			"evil?[2Jname??",
+		},
+		{
+			"bidirectional override",
+			"abc\u202Etxt.exe",
+			"abc?txt.exe",
+		},
+		{
+			"invalid utf-8",
+			"bad\xff\xfename",
+			"bad??name",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			out := sanitizeName(ca.in)
+			if out != ca.out {
+				t.Errorf("expected %q, got %q", ca.out, out)
+			}
+		})
+	}
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	ip = ip.To4()
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
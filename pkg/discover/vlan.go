@@ -0,0 +1,65 @@
+package discover
+
+import (
+	"net"
+	"slices"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// maximum VLAN ID, 4095 is reserved
+const maxVLANID = 4094
+
+// VLAN is a VLAN that is probed with tagged frames.
+//
+// Since the scanner has no address on the VLAN, ARP requests are sent as probes
+// with a zero sender address (RFC 5227) and mDNS requests are sent with
+// a zero source address. NetBIOS requests are not sent, since replies
+// would be addressed to the scanner IP.
+type VLAN struct {
+	ID uint16
+
+	// Ranges are the subnets swept by ARP on the VLAN.
+	Ranges []*net.IPNet
+}
+
+// vlanTarget is a network reachable from an interface: the untagged one
+// (vlan is zero) or one of Options.VLANs.
+type vlanTarget struct {
+	vlan   uint16
+	ranges []*net.IPNet
+}
+
+// frameVLAN returns the VLAN ID of a decoded frame, or zero if the frame is not tagged.
+func frameVLAN(decoded []gopacket.LayerType, dot1q *layers.Dot1Q) uint16 {
+	if slices.Contains(decoded, layers.LayerTypeDot1Q) {
+		return dot1q.VLANIdentifier
+	}
+	return 0
+}
+
+// linkLayers returns the link layers of a frame sent on the given VLAN.
+func linkLayers(src net.HardwareAddr, dst net.HardwareAddr,
+	typ layers.EthernetType, vlan uint16,
+) []gopacket.SerializableLayer {
+	if vlan == 0 {
+		return []gopacket.SerializableLayer{&layers.Ethernet{
+			SrcMAC:       src,
+			DstMAC:       dst,
+			EthernetType: typ,
+		}}
+	}
+
+	return []gopacket.SerializableLayer{
+		&layers.Ethernet{
+			SrcMAC:       src,
+			DstMAC:       dst,
+			EthernetType: layers.EthernetTypeDot1Q,
+		},
+		&layers.Dot1Q{
+			VLANIdentifier: vlan,
+			Type:           typ,
+		},
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// dropPrivileges clears all the capabilities of the process.
+// Capabilities are needed only to open the raw sockets and the HTTP listener,
+// therefore this is called as soon as they are open.
+func dropPrivileges() error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+
+	err := unix.Capget(&hdr, &data[0])
+	if err != nil {
+		return fmt.Errorf("unable to read capabilities: %w", err)
+	}
+
+	if data[0].Permitted == 0 && data[1].Permitted == 0 {
+		return nil
+	}
+
+	data = [2]unix.CapUserData{}
+
+	// capabilities are per-thread, therefore they must be cleared on every thread.
+	// This is not supported when cgo is enabled.
+	_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_CAPSET,
+		uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno != 0 {
+		return fmt.Errorf("unable to drop capabilities: %w", errno)
+	}
+
+	return nil
+}
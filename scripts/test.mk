@@ -17,3 +17,4 @@ test:
 test-nodocker:
 	$(eval export CGO_ENABLED=0)
 	go build -o /dev/null .
+	go test -v ./...
@@ -1,14 +1,17 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"net"
-	"sort"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/nsf/termbox-go"
+
+	"github.com/aler9/landiscover/pkg/discover"
 )
 
 const (
@@ -16,84 +19,134 @@ const (
 	uiColumnPadding = 2
 )
 
-type uiTableColumn string
-
 type uiTableRow struct {
 	id    string
 	cells []string
+	keys  []interface{}
+	fg    termbox.Attribute
+}
+
+// uiPrompt is a line of text edited on the bottom border.
+type uiPrompt struct {
+	label string
+	text  string
+
+	// called after every change, if not nil.
+	onChange func(text string)
+
+	// called when the prompt is confirmed with Enter, if not nil.
+	onDone func(text string)
+
+	// called when the prompt is canceled with Esc, if not nil.
+	onCancel func()
 }
 
 type termboxReq struct {
-	tevt termbox.Event
-	done chan struct{}
+	tevt  termbox.Event
+	shift bool
+	done  chan struct{}
 }
 
 type ui struct {
-	p            *program
+	s            *discover.Scanner
+	inv          *inventory
+	onExit       func()
 	infoText     string
+	alertText    string
+	probesSent   uint64
+	probesTime   time.Time
+	probeRate    float64
+	stopped      bool
 	tableScrollX int
 	tableScrollY int
-	tableSortBy  string
-	tableSortAsc bool
+	tableSort    []uiSortKey
+	relativeTime bool
+	prefsChanged bool
 	tableColumns []uiTableColumn
+	autoColumns  bool
 	tableRows    []uiTableRow
 	selectables  []string
 	selection    string
-
-	termbox   chan termboxReq
-	terminate chan struct{}
-	done      chan struct{}
+	nodes        map[string]discover.Node
+	detail       string
+	filter       uiFilter
+	search       uiFilter // last filter entered, used by n and N
+	prompt       *uiPrompt
+	notice       uiNotice
+	notices      chan uiNotice
+	frozen       []discover.Node
+	activity     map[string]*uiActivity
+	picker       bool
+	pickerItems  []uiTableColumn
+	pickerCursor int
+	tableLayout  uiTableLayout
+	drag         uiDrag
+	lastClick    uiClick
+
+	termbox chan termboxReq
 }
 
-func newUI(p *program) error {
+func newUI(s *discover.Scanner, inv *inventory, columns []string, onExit func()) (*ui, error) {
 	err := termbox.Init()
 	if err != nil {
-		return err
-	}
-
-	ui := &ui{
-		p:            p,
-		infoText:     "",
-		tableSortBy:  "mac",
-		tableSortAsc: true,
-		tableColumns: []uiTableColumn{
-			"last seen",
-			"mac",
-			"ip",
-			"vendor",
-			"dns",
-			"nbns",
-			"mdns",
-		},
-		termbox:   make(chan termboxReq),
-		terminate: make(chan struct{}),
-		done:      make(chan struct{}),
-	}
-
-	p.ui = ui
-	return nil
+		return nil, err
+	}
+
+	termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
+
+	u := &ui{
+		s:        s,
+		inv:      inv,
+		onExit:   onExit,
+		infoText: "",
+		notices:  make(chan uiNotice, 16),
+		activity: make(map[string]*uiActivity),
+		termbox:  make(chan termboxReq),
+	}
+
+	if len(columns) == 0 {
+		u.autoColumns = true
+		u.tableColumns = slices.Clone(uiDefaultColumns)
+		if len(s.Interfaces()) > 1 {
+			u.tableColumns = append(u.tableColumns, "interface")
+		}
+		if inv != nil {
+			u.tableColumns = append(u.tableColumns, "label")
+		}
+	} else {
+		for _, col := range columns {
+			u.tableColumns = append(u.tableColumns, uiTableColumn(col))
+		}
+	}
+
+	prefs := loadUIPrefs()
+	u.relativeTime = prefs.RelativeTime
+
+	u.tableSort = prefs.Sort
+	if len(u.tableSort) == 0 {
+		u.tableSort = []uiSortKey{{Column: "mac", Asc: true}}
+	}
+	u.fixSort()
+
+	return u, nil
 }
 
-func (u *ui) run() {
+// run runs the interface until the context is canceled.
+// It releases the terminal before returning.
+func (u *ui) run(ctx context.Context) error {
 	u.draw()
 
 	termboxDone := make(chan struct{})
 	go func() {
 		defer close(termboxDone)
-		for {
-			tevt := termbox.PollEvent()
-			if tevt.Type == termbox.EventInterrupt {
-				break
-			}
-			done := make(chan struct{})
-			u.termbox <- termboxReq{tevt, done}
-			<-done
-		}
+		u.readInput(termbox.PollRawEvent)
 	}()
 
 	periodicRedrawTicker := time.NewTicker(drawPeriod)
 	defer periodicRedrawTicker.Stop()
 
+	var err error
+
 outer:
 	for {
 		select {
@@ -103,9 +156,35 @@ outer:
 		case req := <-u.termbox:
 			switch req.tevt.Type {
 			case termbox.EventKey:
+				if u.prompt != nil {
+					u.onPromptKey(req.tevt)
+					u.draw()
+					break
+				}
+
+				if u.picker {
+					u.onPickerKey(req.tevt)
+					u.draw()
+					break
+				}
+
 				switch req.tevt.Key {
-				case termbox.KeyEsc, termbox.KeyCtrlC, termbox.KeyCtrlX:
-					close(u.p.terminate)
+				case termbox.KeyEsc:
+					switch {
+					case u.detail != "":
+						u.detail = ""
+						u.draw()
+
+					case u.filter.active():
+						u.filter = uiFilter{}
+						u.draw()
+
+					default:
+						u.onExit()
+					}
+
+				case termbox.KeyCtrlC, termbox.KeyCtrlX:
+					u.onExit()
 
 				case termbox.KeyArrowLeft:
 					u.tableScrollX++
@@ -166,61 +245,351 @@ outer:
 					u.draw()
 
 				case termbox.KeyEnter, termbox.KeySpace:
-					if strings.HasPrefix(u.selection, "col_") {
-						for _, col := range u.tableColumns {
-							if u.selection == "col_"+string(col) {
-								if u.tableSortBy == string(col) {
-									u.tableSortAsc = !u.tableSortAsc
-								} else {
-									u.tableSortBy = string(col)
-									u.tableSortAsc = true
-								}
-								break
-							}
-						}
+					switch {
+					case u.detail != "":
+						u.detail = ""
+
+					case strings.HasPrefix(u.selection, "row_"):
+						u.detail = strings.TrimPrefix(u.selection, "row_")
+
+					case strings.HasPrefix(u.selection, "col_"):
+						u.onSort(uiTableColumn(strings.TrimPrefix(u.selection, "col_")), req.shift)
 					}
 					u.draw()
 
 				default:
 					switch req.tevt.Ch {
 					case 'q', 'Q':
-						close(u.p.terminate)
+						u.onExit()
+
+					case '/':
+						u.prompt = &uiPrompt{
+							label: "/",
+							text:  u.filter.expr,
+							onChange: func(text string) {
+								u.filter = parseUIFilter(text)
+							},
+							onDone: func(text string) {
+								if f := parseUIFilter(text); f.active() {
+									u.search = f
+								}
+							},
+							onCancel: func() {
+								u.filter = uiFilter{}
+							},
+						}
+						u.draw()
+
+					case 'n':
+						u.onNextMatch(1)
+						u.draw()
+
+					case 'N':
+						u.onNextMatch(-1)
+						u.draw()
+
+					case 'f':
+						u.onFreeze()
+						u.draw()
+
+					case 't':
+						u.relativeTime = !u.relativeTime
+						u.prefsChanged = true
+						u.draw()
+
+					case 'm', 'i', 'r', 'p', 'k':
+						if n, ok := u.nodes[strings.TrimPrefix(u.selection, "row_")]; ok {
+							u.onRowAction(ctx, req.tevt.Ch, n)
+						}
+						u.draw()
+
+					case 'c':
+						u.onOpenPicker()
+						u.draw()
 					}
 				}
 
+			case termbox.EventMouse:
+				u.onMouse(req.tevt)
+				u.draw()
+
 			case termbox.EventResize:
 				u.draw()
 
 			case termbox.EventError:
-				panic(req.tevt.Err)
+				err = req.tevt.Err
+				close(req.done)
+				break outer
 			}
 			close(req.done)
 
-		case <-u.terminate:
+		case n := <-u.notices:
+			u.notice = n
+			u.draw()
+
+		case <-ctx.Done():
 			break outer
 		}
 	}
 
+	u.stopInput(termbox.Interrupt, termboxDone)
+	termbox.Close()
+
+	close(u.termbox)
+
+	if u.prefsChanged {
+		err2 := uiPrefs{
+			Sort:         u.tableSort,
+			RelativeTime: u.relativeTime,
+		}.save()
+		if err2 != nil {
+			fmt.Fprintln(os.Stderr, "WAR: unable to save preferences:", err2)
+		}
+	}
+
+	return err
+}
+
+// readInput reads terminal input with poll and sends events to the main loop,
+// one at a time, until poll returns an interrupt.
+func (u *ui) readInput(poll func([]byte) termbox.Event) {
+	buf := make([]byte, 1024)
+	for {
+		tevt := poll(buf)
+		if tevt.Type == termbox.EventInterrupt {
+			return
+		}
+
+		evts := []uiInputEvent{{tevt: tevt}}
+		if tevt.Type == termbox.EventRaw {
+			evts = parseInput(buf[:tevt.N])
+		}
+
+		for _, evt := range evts {
+			done := make(chan struct{})
+			u.termbox <- termboxReq{evt.tevt, evt.shift, done}
+			<-done
+		}
+	}
+}
+
+// stopInput stops readInput once the main loop has returned. Events that are
+// still queued are discarded, in order to let readInput get back to poll,
+// that is the only place where interrupt is received.
+func (u *ui) stopInput(interrupt func(), inputDone <-chan struct{}) {
 	go func() {
-		for {
-			_, ok := <-u.termbox
-			if !ok {
-				return
-			}
+		for req := range u.termbox {
+			close(req.done)
 		}
 	}()
 
-	termbox.Interrupt()
-	<-termboxDone
-	termbox.Close()
+	interrupt()
+	<-inputDone
+}
 
-	close(u.termbox)
-	close(u.done)
+// onPromptKey edits the text of the prompt.
+func (u *ui) onPromptKey(tevt termbox.Event) {
+	p := u.prompt
+
+	switch tevt.Key {
+	case termbox.KeyEnter:
+		u.prompt = nil
+		if p.onDone != nil {
+			p.onDone(p.text)
+		}
+		return
+
+	case termbox.KeyEsc:
+		u.prompt = nil
+		if p.onCancel != nil {
+			p.onCancel()
+		}
+		return
+
+	case termbox.KeyCtrlC:
+		u.onExit()
+		return
+
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		if r := []rune(p.text); len(r) != 0 {
+			p.text = string(r[:len(r)-1])
+		}
+
+	case termbox.KeyCtrlU:
+		p.text = ""
+
+	case termbox.KeySpace:
+		p.text += " "
+
+	default:
+		if tevt.Ch != 0 {
+			p.text += string(tevt.Ch)
+		}
+	}
+
+	if p.onChange != nil {
+		p.onChange(p.text)
+	}
+}
+
+// onFreeze stops or resumes the updates of the table.
+// While the table is frozen, it shows a snapshot of the nodes.
+func (u *ui) onFreeze() {
+	if u.frozen != nil {
+		u.frozen = nil
+		return
+	}
+	u.frozen = u.s.Nodes()
+}
+
+// onSort sorts the table by a column. With add, the column becomes
+// an additional sort key, used when the previous ones are equal.
+// Sorting by a column that is already a key reverses its order.
+func (u *ui) onSort(col uiTableColumn, add bool) {
+	u.prefsChanged = true
+
+	i := slices.IndexFunc(u.tableSort, func(k uiSortKey) bool { return k.Column == col })
+
+	switch {
+	case i == 0 || (i > 0 && add):
+		u.tableSort[i].Asc = !u.tableSort[i].Asc
+
+	case add:
+		u.tableSort = append(u.tableSort, uiSortKey{Column: col, Asc: true})
+
+	default:
+		u.tableSort = []uiSortKey{{Column: col, Asc: true}}
+	}
+}
+
+// fixSort removes the sort keys of columns that are not shown.
+func (u *ui) fixSort() {
+	u.tableSort = slices.DeleteFunc(u.tableSort, func(k uiSortKey) bool {
+		return !slices.Contains(u.tableColumns, k.Column)
+	})
+	if len(u.tableSort) == 0 {
+		u.tableSort = []uiSortKey{{Column: u.tableColumns[0], Asc: true}}
+	}
+}
+
+// sortRows sorts the rows by the sort keys. Ties are broken by ID,
+// so that rows do not move between redraws.
+func (u *ui) sortRows() {
+	slices.SortFunc(u.tableRows, func(a, b uiTableRow) int {
+		for _, k := range u.tableSort {
+			i := slices.Index(u.tableColumns, k.Column)
+			c, _ := findUIColumn(k.Column)
+
+			res := c.compare(a.keys[i], b.keys[i])
+			if !k.Asc {
+				res = -res
+			}
+			if res != 0 {
+				return res
+			}
+		}
+
+		return strings.Compare(a.id, b.id)
+	})
+}
+
+// onOpenPicker opens the column picker, that lists the shown columns
+// in their order, then the hidden ones.
+func (u *ui) onOpenPicker() {
+	u.picker = true
+	u.pickerCursor = 0
+	u.pickerItems = slices.Clone(u.tableColumns)
+	for _, c := range uiColumns {
+		if !slices.Contains(u.pickerItems, c.name) {
+			u.pickerItems = append(u.pickerItems, c.name)
+		}
+	}
+}
+
+// onPickerKey shows, hides and moves columns.
+func (u *ui) onPickerKey(tevt termbox.Event) {
+	item := u.pickerItems[u.pickerCursor]
+	shown := slices.Contains(u.tableColumns, item)
+
+	switch {
+	case tevt.Key == termbox.KeyEsc, tevt.Key == termbox.KeyEnter, tevt.Ch == 'c':
+		u.picker = false
+
+	case tevt.Key == termbox.KeyCtrlC:
+		u.onExit()
+
+	case tevt.Key == termbox.KeyArrowUp:
+		u.pickerCursor = max(u.pickerCursor-1, 0)
+
+	case tevt.Key == termbox.KeyArrowDown:
+		u.pickerCursor = min(u.pickerCursor+1, len(u.pickerItems)-1)
+
+	case tevt.Key == termbox.KeySpace:
+		// at least a column is shown
+		if shown && len(u.tableColumns) == 1 {
+			return
+		}
+		u.setColumns(func(col uiTableColumn) bool {
+			if col == item {
+				return !shown
+			}
+			return slices.Contains(u.tableColumns, col)
+		})
+
+	case tevt.Ch == '+' && u.pickerCursor > 0:
+		u.pickerItems[u.pickerCursor-1], u.pickerItems[u.pickerCursor] = item, u.pickerItems[u.pickerCursor-1]
+		u.pickerCursor--
+		u.setColumns(func(col uiTableColumn) bool { return slices.Contains(u.tableColumns, col) })
+
+	case tevt.Ch == '-' && u.pickerCursor < len(u.pickerItems)-1:
+		u.pickerItems[u.pickerCursor+1], u.pickerItems[u.pickerCursor] = item, u.pickerItems[u.pickerCursor+1]
+		u.pickerCursor++
+		u.setColumns(func(col uiTableColumn) bool { return slices.Contains(u.tableColumns, col) })
+	}
+}
+
+// setColumns shows the picker items that satisfy shown, in the order of the picker.
+// Columns are not added automatically anymore.
+func (u *ui) setColumns(shown func(col uiTableColumn) bool) {
+	var columns []uiTableColumn
+	for _, col := range u.pickerItems {
+		if shown(col) {
+			columns = append(columns, col)
+		}
+	}
+
+	u.tableColumns = columns
+	u.autoColumns = false
+	u.fixSort()
 }
 
-func (u *ui) close() {
-	close(u.terminate)
-	<-u.done
+// onNextMatch selects the next or previous row that matches the last filter
+// entered, that is kept after the filter is cleared. It wraps around at both ends.
+func (u *ui) onNextMatch(delta int) {
+	count := len(u.tableRows)
+	if count == 0 {
+		return
+	}
+
+	cur := slices.IndexFunc(u.tableRows, func(row uiTableRow) bool {
+		return u.selection == "row_"+row.id
+	})
+	if cur < 0 {
+		if delta > 0 {
+			cur = -1
+		} else {
+			cur = count
+		}
+	}
+
+	for step := 1; step <= count; step++ {
+		row := u.tableRows[((cur+delta*step)%count+count)%count]
+
+		if !u.search.active() || u.search.match(u.nodes[row.id], row.cells) {
+			u.selection = "row_" + row.id
+			return
+		}
+	}
 }
 
 func (u *ui) onMoveY(value int) {
@@ -248,122 +617,422 @@ func (u *ui) draw() {
 
 	termWidth, termHeight := termbox.Size() // must be called after Clear()
 
-	u.drawRect(0, 0, termWidth, 3)
+	// the status area grows when there are alerts
+	statusHeight := 3
+	if u.alertText != "" {
+		statusHeight = 4
+	}
+
+	u.drawRect(0, 0, termWidth, statusHeight)
 
 	u.drawClippedText(1, termWidth-2, 1, 1, u.infoText,
 		termbox.ColorWhite, termbox.ColorBlack)
 
-	u.drawRect(0, 3, termWidth, termHeight-3)
+	if u.alertText != "" {
+		u.drawClippedText(1, termWidth-2, 1, 2, u.alertText,
+			termbox.ColorRed, termbox.ColorBlack)
+	}
+
+	u.drawRect(0, statusHeight, termWidth, termHeight-statusHeight)
 
-	u.drawScrollableTable(1, 4, termWidth-2, termHeight-5,
-		u.selection, u.tableSortBy, u.tableSortAsc,
+	u.drawScrollableTable(1, statusHeight+1, termWidth-2, termHeight-statusHeight-2,
+		u.selection, u.tableSort,
 		u.tableColumns, u.tableRows, &u.tableScrollX, &u.tableScrollY)
 
+	if n, ok := u.nodes[u.detail]; ok {
+		u.drawDetail(termWidth, termHeight, n)
+	}
+
+	if u.picker {
+		u.drawPicker(termWidth, termHeight)
+	}
+
+	// the prompt and notices are drawn on the bottom border
+	switch {
+	case u.prompt != nil:
+		text := " " + u.prompt.label + u.prompt.text
+		u.drawClippedText(1, termWidth-2, 1, termHeight-1, text+" ",
+			termbox.ColorYellow, termbox.ColorBlack)
+		termbox.SetCursor(1+textWidth(text), termHeight-1)
+
+	case u.notice.text != "" && time.Since(u.notice.time) < noticeDuration:
+		termbox.HideCursor()
+		u.drawClippedText(1, termWidth-2, 1, termHeight-1, " "+u.notice.text+" ",
+			u.notice.fg, termbox.ColorBlack)
+
+	default:
+		termbox.HideCursor()
+	}
+
 	termbox.Flush() //nolint:errcheck
 }
 
+func vlanText(vlan uint16) string {
+	if vlan == 0 {
+		return "-"
+	}
+	return strconv.Itoa(int(vlan))
+}
+
+func probeText(ps discover.ProbeStatus) string {
+	switch ps.State {
+	case discover.ProbeNone:
+		return "not sent"
+
+	case discover.ProbePending:
+		if ps.Attempts == 0 {
+			return "queued"
+		}
+		return fmt.Sprintf("pending (attempt %d, sent %s)",
+			ps.Attempts, ps.LastAttempt.Format("15:04:05"))
+
+	case discover.ProbeAnswered:
+		return fmt.Sprintf("answered (attempts: %d)", ps.Attempts)
+	}
+
+	return fmt.Sprintf("no response (attempts: %d)", ps.Attempts)
+}
+
+// drawDetail draws a box with all the information about a node.
+func (u *ui) drawDetail(termWidth int, termHeight int, n discover.Node) {
+	lines := []string{
+		"mac:        " + n.MAC.String(),
+		"ip:         " + n.IP.String(),
+		"interface:  " + n.Interface,
+		"vlan:       " + vlanText(n.VLAN),
+		"vendor:     " + orDash(discover.MacVendor(n.MAC)),
+		"gateway:    " + fmt.Sprint(n.Gateway),
+		"online:     " + fmt.Sprint(n.Online),
+		"first seen: " + n.FirstSeen.Format("Jan 2 15:04:05"),
+		"last seen:  " + n.LastSeen.Format("Jan 2 15:04:05"),
+		"sightings:  " + strconv.Itoa(n.Sightings),
+		"method:     " + orDash(n.Method),
+		"dns:        " + orDash(n.DNS),
+		"nbns:       " + orDash(n.NBNS),
+		"mdns:       " + orDash(n.MDNS),
+		"os:         " + orDash(osGuess(n)),
+		"services:   " + orDash(servicesText(n.Services)),
+	}
+
+	if u.inv != nil {
+		m := u.inv.match(n)
+		lines = append(lines, "inventory:  "+m.status.String())
+		if m.knownMAC {
+			lines = append(lines, "label:      "+orDash(m.device.Label))
+		}
+		if m.reason != "" {
+			lines = append(lines, "mismatch:   "+m.reason)
+		}
+	}
+
+	lines = append(lines,
+		"",
+		"dns probe:  "+probeText(n.Probes.DNS),
+		"nbns probe: "+probeText(n.Probes.NBNS),
+		"mdns probe: "+probeText(n.Probes.MDNS),
+	)
+
+	u.drawPopup(termWidth, termHeight, lines, -1)
+}
+
+// drawPicker draws the column picker.
+func (u *ui) drawPicker(termWidth int, termHeight int) {
+	var lines []string
+	for _, col := range u.pickerItems {
+		if slices.Contains(u.tableColumns, col) {
+			lines = append(lines, "[x] "+string(col))
+		} else {
+			lines = append(lines, "[ ] "+string(col))
+		}
+	}
+
+	lines = append(lines,
+		"",
+		"space: show/hide    +/-: move    enter: close")
+
+	u.drawPopup(termWidth, termHeight, lines, u.pickerCursor)
+}
+
+// drawPopup draws a box with lines of text in the middle of the screen.
+// The line with index highlight is drawn in reverse colors.
+func (u *ui) drawPopup(termWidth int, termHeight int, lines []string, highlight int) {
+	width := 0
+	for _, l := range lines {
+		width = max(width, textWidth(l))
+	}
+	width = min(width+4, termWidth)
+	height := min(len(lines)+2, termHeight)
+
+	startX := (termWidth - width) / 2
+	startY := (termHeight - height) / 2
+
+	for y := startY; y < startY+height; y++ {
+		for x := startX; x < startX+width; x++ {
+			termbox.SetCell(x, y, ' ', termbox.ColorWhite, termbox.ColorBlack)
+		}
+	}
+	u.drawRect(startX, startY, width, height)
+
+	for i, l := range lines {
+		if i >= height-2 {
+			break
+		}
+
+		fg, bg := termbox.ColorWhite, termbox.ColorBlack
+		if i == highlight {
+			fg, bg = bg, fg
+		}
+
+		u.drawClippedText(startX+1, startX+width-2, startX+2, startY+1+i, l, fg, bg)
+	}
+}
+
+// uiNodeID returns an identifier of a node that is unique in the table.
+func uiNodeID(n discover.Node) string {
+	return fmt.Sprintf("%s_%s_%s_%d", n.MAC.String(), n.IP.String(), n.Interface, n.VLAN)
+}
+
 func (u *ui) gatherData() {
-	resNodes := make(chan map[nodeKey]*node)
-	done := make(chan struct{})
-	u.p.uiGetData <- uiGetDataReq{
-		resNodes: resNodes,
-		done:     done,
+	nodes := u.frozen
+	if nodes == nil {
+		nodes = u.s.Nodes()
 	}
-	nodes := <-resNodes
 
-	// program is terminating
+	// scanner is terminating, or the scan is complete in once mode
 	if nodes == nil {
+		if !u.stopped {
+			u.stopped = true
+			if u.s.Complete() {
+				u.infoText += "    scan complete"
+			} else {
+				u.infoText += "    scanner stopped"
+			}
+		}
 		return
 	}
 
+	unknown := 0
+	mismatch := 0
+	gateways := make(map[string]discover.Node)
+	u.nodes = make(map[string]discover.Node, len(nodes))
+
+	// the vlan column is shown as soon as a tagged node is found
+	if u.autoColumns && !slices.Contains(u.tableColumns, "vlan") &&
+		slices.ContainsFunc(nodes, func(n discover.Node) bool { return n.VLAN != 0 }) {
+		u.tableColumns = slices.Insert(u.tableColumns,
+			slices.Index(u.tableColumns, "ip")+1, "vlan")
+	}
+
+	// count recent sightings. The counts stay still while the table is frozen.
+	if u.frozen == nil {
+		now := time.Now()
+		ids := make(map[string]struct{}, len(nodes))
+
+		for _, n := range nodes {
+			id := uiNodeID(n)
+			ids[id] = struct{}{}
+
+			if a, ok := u.activity[id]; ok {
+				a.update(n.Sightings, now)
+			} else {
+				u.activity[id] = newUIActivity(n.Sightings, n.FirstSeen, now)
+			}
+		}
+
+		for id := range u.activity {
+			if _, ok := ids[id]; !ok {
+				delete(u.activity, id)
+			}
+		}
+	}
+
+	// position of the selected row before the update
+	oldIndex := slices.IndexFunc(u.tableRows, func(row uiTableRow) bool {
+		return u.selection == "row_"+row.id
+	})
+
 	u.tableRows = func() []uiTableRow {
 		var ret []uiTableRow
 		for _, n := range nodes {
-			row := uiTableRow{
-				id: fmt.Sprintf("%s_%s", n.mac.String(), n.ip.String()),
-				cells: []string{
-					n.lastSeen.Format("Jan 2 15:04:05"),
-					n.mac.String(),
-					n.ip.String(),
-					macVendor(n.mac),
-					func() string {
-						if n.dns == "" {
-							return "-"
-						}
-						return n.dns
-					}(),
-					func() string {
-						if n.nbns == "" {
-							return "-"
-						}
-						return n.nbns
-					}(),
-					func() string {
-						if n.mdns == "" {
-							return "-"
-						}
-						return n.mdns
-					}(),
-				},
+			id := uiNodeID(n)
+			u.nodes[id] = n
+
+			row := uiTableRow{id: id}
+			label := "-"
+
+			if u.inv != nil {
+				m := u.inv.match(n)
+				switch m.status {
+				case inventoryKnown:
+					label = m.device.Label
+
+				case inventoryMismatch:
+					if m.knownMAC {
+						label = m.device.Label + " (" + m.reason + ")"
+					} else {
+						label = "unknown (" + m.reason + ")"
+					}
+					row.fg = termbox.ColorYellow
+					mismatch++
+
+				default:
+					label = "unknown"
+					row.fg = termbox.ColorRed
+					unknown++
+				}
+			}
+
+			for _, col := range u.tableColumns {
+				c, _ := findUIColumn(col)
+
+				cell := label
+				if c.text != nil {
+					cell = c.text(u, n)
+				}
+
+				var key interface{} = cell
+				if c.key != nil {
+					key = c.key(u, n)
+				}
+
+				row.cells = append(row.cells, cell)
+				row.keys = append(row.keys, key)
+			}
+
+			// inventory problems take precedence over the freshness of the node
+			if row.fg == termbox.ColorDefault {
+				if n.Gateway && n.Online {
+					row.fg = termbox.ColorCyan
+				} else {
+					row.fg = freshnessColor(n)
+				}
+			}
+
+			if n.Gateway {
+				row.fg |= termbox.AttrBold
+
+				// a spoofed gateway shows up as an additional node
+				if gw, ok := gateways[n.Interface]; !ok || n.LastSeen.After(gw.LastSeen) {
+					gateways[n.Interface] = n
+				}
+			}
+
+			if u.filter.active() && !u.filter.match(n, row.cells) {
+				continue
 			}
+
 			ret = append(ret, row)
 		}
 		return ret
 	}()
 
-	close(done)
+	// measure the current rate of sent packets
+	now := time.Now()
+	probesSent := uint64(0)
+	for _, ms := range u.s.Stats().Methods {
+		probesSent += ms.ProbesSent
+	}
+	if !u.probesTime.IsZero() && now.Sub(u.probesTime) >= drawPeriod {
+		u.probeRate = float64(probesSent-u.probesSent) / now.Sub(u.probesTime).Seconds()
+	}
+	if u.probesTime.IsZero() || now.Sub(u.probesTime) >= drawPeriod {
+		u.probesSent = probesSent
+		u.probesTime = now
+	}
 
-	u.infoText = fmt.Sprintf("interface: %s%s    entries: %d    last update: %s",
-		u.p.intf.Name,
+	u.infoText = fmt.Sprintf("interface: %s%s    gateway: %s    entries: %s%s%s    rate: %.1f pkt/s%s    last update: %s",
 		func() string {
-			if u.p.passiveMode {
+			var names []string
+			for _, in := range u.s.Interfaces() {
+				names = append(names, in.Name)
+			}
+			return strings.Join(names, ", ")
+		}(),
+		func() string {
+			if u.s.Passive() {
 				return " (passive mode)"
 			}
 			return ""
 		}(),
-		len(u.tableRows),
-		time.Now().Format("Jan 2 15:04:05"))
+		func() string {
+			intfs := u.s.Interfaces()
+
+			var parts []string
+			for _, in := range intfs {
+				var part string
+				gw, seen := gateways[in.Name]
+
+				switch {
+				case in.Gateway == nil:
+					part = "none"
+				case !seen:
+					part = in.Gateway.String() + " (not seen)"
+				default:
+					part = fmt.Sprintf("%s %s (%s)", gw.IP, gw.MAC, discover.MacVendor(gw.MAC))
+				}
 
-	sort.Slice(u.tableRows, func(i, j int) bool {
-		n := 0
-		switch u.tableSortBy {
-		case "last seen":
-			n = 0
-		case "mac":
-			n = 1
-		case "ip":
-			n = 2
-		case "vendor":
-			n = 3
-		case "dns":
-			n = 4
-		case "nbns":
-			n = 5
-		case "mdns":
-			n = 6
-		}
-
-		if u.tableSortBy == "ip" {
-			if u.tableRows[i].cells[n] != u.tableRows[j].cells[n] {
-				ipa := net.ParseIP(u.tableRows[i].cells[n])
-				ipb := net.ParseIP(u.tableRows[j].cells[n])
-
-				if u.tableSortAsc {
-					return bytes.Compare(ipa, ipb) < 0
+				if len(intfs) > 1 {
+					part = in.Name + " " + part
 				}
-				return bytes.Compare(ipa, ipb) >= 0
+				parts = append(parts, part)
 			}
-		} else {
-			if u.tableRows[i].cells[n] != u.tableRows[j].cells[n] {
-				if u.tableSortAsc {
-					return u.tableRows[i].cells[n] < u.tableRows[j].cells[n]
+			return strings.Join(parts, ", ")
+		}(),
+		func() string {
+			ret := strconv.Itoa(len(nodes))
+			if u.filter.active() {
+				ret = fmt.Sprintf("%d of %d (filter: %s)", len(u.tableRows), len(nodes), u.filter.expr)
+			}
+			if u.frozen != nil {
+				ret += " (frozen)"
+			}
+			return ret
+		}(),
+		func() string {
+			if u.inv == nil {
+				return ""
+			}
+			return fmt.Sprintf("    unknown: %d    mismatch: %d", unknown, mismatch)
+		}(),
+		func() string {
+			servers := u.s.DHCPServers()
+			if len(servers) == 0 {
+				return ""
+			}
+			rogue := 0
+			for _, srv := range servers {
+				if !srv.Allowed {
+					rogue++
 				}
-				return u.tableRows[i].cells[n] > u.tableRows[j].cells[n]
 			}
+			return fmt.Sprintf("    dhcp servers: %d (rogue: %d)", len(servers), rogue)
+		}(),
+		u.probeRate,
+		func() string {
+			if u.s.Passive() {
+				return ""
+			}
+			p := u.s.SweepProgress()
+			if p.Pass != 0 {
+				return fmt.Sprintf("    sweep: %d/%d (retry %d)", p.Sent, p.Total, p.Pass)
+			}
+			return fmt.Sprintf("    sweep: %d/%d", p.Sent, p.Total)
+		}(),
+		time.Now().Format("Jan 2 15:04:05"))
+
+	u.alertText = func() string {
+		alerts := u.s.Alerts()
+		if len(alerts) == 0 {
+			return ""
 		}
+		last := alerts[len(alerts)-1]
+		return fmt.Sprintf("alerts: %d    last: %s %s",
+			len(alerts),
+			last.Time.Format("Jan 2 15:04:05"),
+			last.Message)
+	}()
 
-		return u.tableRows[i].cells[2] < u.tableRows[j].cells[2]
-	})
+	u.sortRows()
 
 	u.selectables = nil
 	for _, col := range u.tableColumns {
@@ -373,8 +1042,22 @@ func (u *ui) gatherData() {
 		u.selectables = append(u.selectables, "row_"+row.id)
 	}
 
-	if u.selection == "" {
-		u.selection = u.selectables[0]
+	// the selected row can be hidden by the filter
+	if !slices.Contains(u.selectables, u.selection) {
+		if strings.HasPrefix(u.selection, "row_") && len(u.tableRows) != 0 {
+			u.selection = "row_" + u.tableRows[0].id
+		} else {
+			u.selection = u.selectables[0]
+		}
+	}
+
+	// the table is scrolled in order to keep the selected node
+	// at the same position on the screen when rows move
+	newIndex := slices.IndexFunc(u.tableRows, func(row uiTableRow) bool {
+		return u.selection == "row_"+row.id
+	})
+	if oldIndex >= 0 && newIndex >= 0 {
+		u.tableScrollY -= newIndex - oldIndex
 	}
 }
 
@@ -398,16 +1081,13 @@ func (u *ui) drawRect(startX int, startY int, width int, height int) {
 }
 
 func (u *ui) drawClippedText(startX, endX, x, y int, text string, fg, bg termbox.Attribute) {
-	for _, r := range text {
-		if x >= startX && x <= endX {
-			termbox.SetCell(x, y, r, fg, bg)
-		}
-		x++
+	for _, c := range clipText(startX, endX, x, text) {
+		termbox.SetCell(c.x, y, c.ch, fg, bg)
 	}
 }
 
 func (u *ui) drawScrollableTable(startX int, startY int, width int, height int,
-	selection string, sortBy string, sortAsc bool, columns []uiTableColumn,
+	selection string, sortKeys []uiSortKey, columns []uiTableColumn,
 	rows []uiTableRow, scrollX *int, scrollY *int,
 ) {
 	endX := startX + width - 1
@@ -416,15 +1096,15 @@ func (u *ui) drawScrollableTable(startX int, startY int, width int, height int,
 	// compute columns width
 	colWidths := make([]int, len(columns))
 	for i, col := range columns {
-		width2 := len(col) + 2 // leave additional space for order arrow
+		width2 := textWidth(string(col)) + 4 // leave additional space for order arrow and key index
 		if colWidths[i] < width2 {
 			colWidths[i] = width2
 		}
 	}
 	for _, row := range rows {
 		for i, cell := range row.cells {
-			if colWidths[i] < len(cell) {
-				colWidths[i] = len(cell)
+			if w := min(textWidth(cell), uiMaxCellWidth); colWidths[i] < w {
+				colWidths[i] = w
 			}
 		}
 	}
@@ -467,16 +1147,31 @@ func (u *ui) drawScrollableTable(startX int, startY int, width int, height int,
 	}
 
 	// draw scrollbars
-	u.drawScrollbar(true, endX, startY, height, tableHeight, *scrollY)
-	u.drawScrollbar(false, endY, startX, width, tableWidth, *scrollX)
+	vbar := u.drawScrollbar(true, endX, startY, height, tableHeight, *scrollY)
+	hbar := u.drawScrollbar(false, endY, startX, width, tableWidth, *scrollX)
 
 	// reduce space
 	endX--
 	endY--
 
+	u.tableLayout = uiTableLayout{
+		vbarX:     endX + 1,
+		hbarY:     endY + 1,
+		headerY:   startY,
+		firstRowY: startY + 2 + *scrollY,
+		rowsY:     [2]int{startY + 2, endY},
+		vbar:      vbar,
+		hbar:      hbar,
+	}
+
 	// draw columns
 	x := startX + *scrollX
 	for i, col := range columns {
+		u.tableLayout.columns = append(u.tableLayout.columns, uiLayoutColumn{
+			name: col,
+			x:    [2]int{max(x, startX), min(x+colWidths[i]+uiColumnPadding, endX+1)},
+		})
+
 		fg := termbox.ColorWhite
 		bg := termbox.ColorBlack
 		if selection == "col_"+string(col) {
@@ -485,12 +1180,17 @@ func (u *ui) drawScrollableTable(startX int, startY int, width int, height int,
 		}
 
 		text := string(col)
-		if sortBy == string(col) {
-			if sortAsc {
+		if j := slices.IndexFunc(sortKeys, func(k uiSortKey) bool { return k.Column == col }); j >= 0 {
+			if sortKeys[j].Asc {
 				text += " " + string(rune(0x25B2))
 			} else {
 				text += " " + string(rune(0x25BC))
 			}
+
+			// the priority is shown when there are multiple keys
+			if len(sortKeys) > 1 {
+				text += strconv.Itoa(j + 1)
+			}
 		}
 		u.drawClippedText(startX, endX, x, startY, text, fg, bg)
 		x += colWidths[i] + uiColumnPadding
@@ -501,15 +1201,18 @@ func (u *ui) drawScrollableTable(startX int, startY int, width int, height int,
 	for _, row := range rows {
 		fg := termbox.ColorWhite
 		bg := termbox.ColorBlack
+		if row.fg != termbox.ColorDefault {
+			fg = row.fg
+		}
 		if selection == "row_"+row.id {
+			bg = fg
 			fg = termbox.ColorBlack
-			bg = termbox.ColorWhite
 		}
 
 		if y >= (startY+2) && y <= endY {
 			x := startX + *scrollX
 			for i, cell := range row.cells {
-				u.drawClippedText(startX, endX, x, y, cell, fg, bg)
+				u.drawClippedText(startX, endX, x, y, truncateText(cell, colWidths[i]), fg, bg)
 				x += colWidths[i] + uiColumnPadding
 			}
 		}
@@ -519,7 +1222,9 @@ func (u *ui) drawScrollableTable(startX int, startY int, width int, height int,
 
 func (u *ui) drawScrollbar(vertical bool, fixedCoord int, start int,
 	screenSize int, pageSize int, cur int,
-) {
+) uiScrollbar {
+	origin := start
+
 	scrollbarMaxSize := screenSize - 1
 	scrollbarSize := scrollbarMaxSize
 	if pageSize > scrollbarMaxSize {
@@ -541,4 +1246,12 @@ func (u *ui) drawScrollbar(vertical bool, fixedCoord int, start int,
 			termbox.SetCell(x, fixedCoord, 0x2585, termbox.ColorGreen, termbox.ColorBlack)
 		}
 	}
+
+	return uiScrollbar{
+		origin: origin,
+		start:  start,
+		size:   scrollbarSize,
+		zone:   scrollZone,
+		minVal: minVal,
+	}
 }
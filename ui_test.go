@@ -0,0 +1,216 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+func TestSortRows(t *testing.T) {
+	row := func(id string, ip string, sightings int, dns string) uiTableRow {
+		return uiTableRow{
+			id:   id,
+			keys: []interface{}{net.ParseIP(ip).To4(), sightings, dns},
+		}
+	}
+
+	rows := []uiTableRow{
+		row("a", "10.0.0.10", 5, "b.lan"),
+		row("b", "10.0.0.9", 7, "a.lan"),
+		row("c", "10.0.0.10", 7, "a.lan"),
+		row("d", "10.0.0.9", 5, "b.lan"),
+		row("e", "10.0.0.10", 5, "b.lan"),
+	}
+
+	for _, ca := range []struct {
+		name  string
+		sort  []uiSortKey
+		order string
+	}{
+		{
+			"single key",
+			[]uiSortKey{{Column: "ip", Asc: true}},
+			"b,d,a,c,e",
+		},
+		{
+			"descending",
+			[]uiSortKey{{Column: "sightings", Asc: false}},
+			"b,c,a,d,e",
+		},
+		{
+			"multiple keys",
+			[]uiSortKey{{Column: "dns", Asc: true}, {Column: "ip", Asc: false}},
+			"c,b,a,e,d",
+		},
+		{
+			"ties broken by id",
+			[]uiSortKey{{Column: "ip", Asc: false}, {Column: "sightings", Asc: true}, {Column: "dns", Asc: true}},
+			"a,e,c,d,b",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			u := &ui{
+				tableColumns: []uiTableColumn{"ip", "sightings", "dns"},
+				tableSort:    ca.sort,
+			}
+
+			// rows are sorted in the same way regardless of their initial order
+			for _, initial := range [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}} {
+				u.tableRows = nil
+				for _, i := range initial {
+					u.tableRows = append(u.tableRows, rows[i])
+				}
+
+				u.sortRows()
+
+				var ids []string
+				for _, r := range u.tableRows {
+					ids = append(ids, r.id)
+				}
+				if strings.Join(ids, ",") != ca.order {
+					t.Errorf("expected %s, got %s", ca.order, strings.Join(ids, ","))
+				}
+			}
+		})
+	}
+}
+
+func TestOnSort(t *testing.T) {
+	u := &ui{
+		tableColumns: []uiTableColumn{"ip", "sightings", "dns"},
+		tableSort:    []uiSortKey{{Column: "ip", Asc: true}},
+	}
+
+	for _, step := range []struct {
+		col  uiTableColumn
+		add  bool
+		sort []uiSortKey
+	}{
+		{"ip", false, []uiSortKey{{"ip", false}}},
+		{"dns", true, []uiSortKey{{"ip", false}, {"dns", true}}},
+		{"sightings", true, []uiSortKey{{"ip", false}, {"dns", true}, {"sightings", true}}},
+		{"dns", true, []uiSortKey{{"ip", false}, {"dns", false}, {"sightings", true}}},
+		{"ip", true, []uiSortKey{{"ip", true}, {"dns", false}, {"sightings", true}}},
+		{"dns", false, []uiSortKey{{"dns", true}}},
+	} {
+		u.onSort(step.col, step.add)
+		if !reflect.DeepEqual(u.tableSort, step.sort) {
+			t.Fatalf("after sorting by %s: unexpected keys %v", step.col, u.tableSort)
+		}
+	}
+
+	if !u.prefsChanged {
+		t.Error("preferences were not marked as changed")
+	}
+
+	// keys of hidden columns are removed
+	u.tableColumns = []uiTableColumn{"ip", "sightings"}
+	u.fixSort()
+	if !reflect.DeepEqual(u.tableSort, []uiSortKey{{"ip", true}}) {
+		t.Errorf("unexpected keys %v", u.tableSort)
+	}
+}
+
+func TestStopInput(t *testing.T) {
+	u := &ui{termbox: make(chan termboxReq)}
+
+	// like termbox, the interrupt is received by poll only
+	polls := make(chan termbox.Event)
+	poll := func(buf []byte) termbox.Event {
+		tevt := <-polls
+		if tevt.Type == termbox.EventRaw {
+			// a single read that contains several keys
+			tevt.N = copy(buf, "abc")
+		}
+		return tevt
+	}
+	interrupt := func() {
+		polls <- termbox.Event{Type: termbox.EventInterrupt}
+	}
+
+	inputDone := make(chan struct{})
+	go func() {
+		defer close(inputDone)
+		u.readInput(poll)
+	}()
+
+	go func() {
+		polls <- termbox.Event{Type: termbox.EventRaw}
+	}()
+
+	// the main loop handles the first key, then quits
+	req := <-u.termbox
+	close(req.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		u.stopInput(interrupt, inputDone)
+		close(u.termbox)
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("input reader was not stopped")
+	}
+}
+
+func TestOnNextMatch(t *testing.T) {
+	u := &ui{
+		nodes: map[string]discover.Node{
+			"a": {DNS: "pi.lan"},
+			"b": {DNS: "laptop.lan"},
+			"c": {DNS: "pi2.lan"},
+			"d": {DNS: "nas.lan"},
+		},
+	}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		u.tableRows = append(u.tableRows, uiTableRow{id: id})
+	}
+
+	// without a filter, every row matches
+	u.onNextMatch(-1)
+	if u.selection != "row_d" {
+		t.Fatalf("unexpected selection: %s", u.selection)
+	}
+
+	u.search = parseUIFilter("name:pi")
+	u.selection = ""
+
+	for _, step := range []struct {
+		delta     int
+		selection string
+	}{
+		{1, "row_a"},
+		{1, "row_c"},
+		{1, "row_a"},
+		{-1, "row_c"},
+		{-1, "row_a"},
+		{-1, "row_c"},
+	} {
+		u.onNextMatch(step.delta)
+		if u.selection != step.selection {
+			t.Fatalf("expected %s, got %s", step.selection, u.selection)
+		}
+	}
+
+	// the search starts from the selected row, also when it does not match
+	u.selection = "row_b"
+	u.onNextMatch(1)
+	if u.selection != "row_c" {
+		t.Errorf("unexpected selection: %s", u.selection)
+	}
+
+	u.search = parseUIFilter("name:printer")
+	u.onNextMatch(1)
+	if u.selection != "row_c" {
+		t.Errorf("unexpected selection: %s", u.selection)
+	}
+}
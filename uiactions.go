@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+const noticeDuration = 5 * time.Second
+
+// uiNotice is the result of an action, shown on the bottom border for a few seconds.
+type uiNotice struct {
+	text string
+	fg   termbox.Attribute
+	time time.Time
+}
+
+func newNotice(fg termbox.Attribute, format string, args ...interface{}) uiNotice {
+	return uiNotice{
+		text: fmt.Sprintf(format, args...),
+		fg:   fg,
+		time: time.Now(),
+	}
+}
+
+func errorNotice(err error) uiNotice {
+	return newNotice(termbox.ColorRed, "%v", err)
+}
+
+// notify shows a notice. It can be called by any goroutine.
+func (u *ui) notify(n uiNotice) {
+	select {
+	case u.notices <- n:
+	default:
+	}
+}
+
+// copyText copies text to the clipboard of the terminal with the OSC 52 sequence,
+// that works through SSH too. Terminals that do not support it ignore it.
+// The sequence is written to the terminal used by termbox, after its pending output.
+func copyText(text string) error {
+	err := termbox.Flush()
+	if err != nil {
+		return err
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+
+	_, err = fmt.Fprintf(tty, "\x1b]52;c;%s\x07",
+		base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
+
+// onRowAction performs an action on the node of the selected row.
+// Background actions are canceled with the context.
+func (u *ui) onRowAction(ctx context.Context, action rune, n discover.Node) {
+	switch action {
+	case 'm', 'i':
+		text := n.MAC.String()
+		if action == 'i' {
+			text = n.IP.String()
+		}
+
+		err := copyText(text)
+		if err != nil {
+			u.notice = errorNotice(err)
+			return
+		}
+		u.notice = newNotice(termbox.ColorGreen, "copied %s", text)
+
+	case 'r':
+		err := u.s.Reprobe(ctx, n)
+		if err != nil {
+			u.notice = errorNotice(err)
+			return
+		}
+		u.notice = newNotice(termbox.ColorGreen, "probing %s again", n.IP)
+
+	case 'p':
+		u.notice = newNotice(termbox.ColorYellow, "pinging %s...", n.IP)
+
+		go func() {
+			rtt, err := u.s.Ping(ctx, n)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				u.notify(errorNotice(err))
+				return
+			}
+			u.notify(newNotice(termbox.ColorGreen, "reply from %s in %s",
+				n.IP, rtt.Round(10*time.Microsecond)))
+		}()
+
+	case 'k':
+		if u.inv == nil {
+			u.notice = errorNotice(fmt.Errorf("an inventory file is required (--inventory)"))
+			return
+		}
+
+		u.prompt = &uiPrompt{
+			label: "label of " + n.MAC.String() + ": ",
+			text:  hostname(n),
+			onDone: func(label string) {
+				err := u.inv.add(n, label)
+				if err != nil {
+					u.notice = errorNotice(err)
+					return
+				}
+				u.notice = newNotice(termbox.ColorGreen, "%s added to the inventory", n.MAC)
+			},
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+const (
+	activityBuckets = 8
+	activityBucket  = 10 * time.Second
+
+	// nodes seen within freshPeriod are shown in green.
+	freshPeriod = 30 * time.Second
+)
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// uiActivity counts the sightings of a node over the last
+// activityBuckets*activityBucket, in order to draw a sparkline.
+type uiActivity struct {
+	sightings int
+	counts    [activityBuckets]int // oldest first
+	start     time.Time            // start of the last bucket
+}
+
+func newUIActivity(sightings int, firstSeen time.Time, now time.Time) *uiActivity {
+	a := &uiActivity{
+		sightings: sightings,
+		start:     now,
+	}
+
+	// sightings of a node that has just been found are recent
+	if now.Sub(firstSeen) < activityBucket {
+		a.counts[activityBuckets-1] = sightings
+	}
+
+	return a
+}
+
+// update adds the sightings since the last update to the last bucket,
+// after discarding the buckets that are over.
+func (a *uiActivity) update(sightings int, now time.Time) {
+	for i := 0; i < activityBuckets && now.Sub(a.start) >= activityBucket; i++ {
+		copy(a.counts[:], a.counts[1:])
+		a.counts[activityBuckets-1] = 0
+		a.start = a.start.Add(activityBucket)
+	}
+
+	// the node was not updated for the whole window
+	if now.Sub(a.start) >= activityBucket {
+		a.start = now
+	}
+
+	a.counts[activityBuckets-1] += sightings - a.sightings
+	a.sightings = sightings
+}
+
+func (a *uiActivity) total() int {
+	if a == nil {
+		return 0
+	}
+
+	ret := 0
+	for _, c := range a.counts {
+		ret += c
+	}
+	return ret
+}
+
+// text returns a sparkline of the buckets, scaled on the busiest one,
+// followed by the number of recent sightings.
+func (a *uiActivity) text() string {
+	if a == nil {
+		return "-"
+	}
+
+	highest := 0
+	for _, c := range a.counts {
+		highest = max(highest, c)
+	}
+
+	var b strings.Builder
+	for _, c := range a.counts {
+		switch {
+		case c == 0:
+			b.WriteRune(' ')
+		case highest == 1:
+			b.WriteRune(sparkRunes[len(sparkRunes)-1])
+		default:
+			b.WriteRune(sparkRunes[(c-1)*(len(sparkRunes)-1)/(highest-1)])
+		}
+	}
+
+	return b.String() + " " + strconv.Itoa(a.total())
+}
+
+// freshnessColor returns the color of a row: green when the node
+// has just been seen, yellow when it is stale, gray when it is offline.
+func freshnessColor(n discover.Node) termbox.Attribute {
+	switch {
+	case !n.Online:
+		return termbox.ColorDarkGray
+
+	case time.Since(n.LastSeen) < freshPeriod:
+		return termbox.ColorGreen
+	}
+
+	return termbox.ColorYellow
+}
+
+// timeText returns a time as a clock time, or relative to now, like "12m ago".
+func (u *ui) timeText(t time.Time) string {
+	if !u.relativeTime {
+		return t.Format("Jan 2 15:04:05")
+	}
+
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return strconv.Itoa(int(max(d, 0)/time.Second)) + "s ago"
+
+	case d < time.Hour:
+		return strconv.Itoa(int(d/time.Minute)) + "m ago"
+
+	case d < 24*time.Hour:
+		return strconv.Itoa(int(d/time.Hour)) + "h ago"
+	}
+
+	return strconv.Itoa(int(d/(24*time.Hour))) + "d ago"
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+func TestUIActivity(t *testing.T) {
+	now := time.Now()
+
+	// sightings of a node found before the first update are not recent
+	a := newUIActivity(10, now.Add(-time.Hour), now)
+	if a.total() != 0 || a.text() != "         0" {
+		t.Fatalf("unexpected activity: %q", a.text())
+	}
+
+	a = newUIActivity(3, now.Add(-2*time.Second), now)
+
+	for _, step := range []struct {
+		name      string
+		sightings int
+		at        time.Duration
+		counts    [activityBuckets]int
+		text      string
+	}{
+		{
+			"new node",
+			3,
+			0,
+			[activityBuckets]int{0, 0, 0, 0, 0, 0, 0, 3},
+			"       █ 3",
+		},
+		{
+			"same bucket",
+			5,
+			5 * time.Second,
+			[activityBuckets]int{0, 0, 0, 0, 0, 0, 0, 5},
+			"       █ 5",
+		},
+		{
+			"next bucket",
+			6,
+			12 * time.Second,
+			[activityBuckets]int{0, 0, 0, 0, 0, 0, 5, 1},
+			"      █▁ 6",
+		},
+		{
+			"skipped buckets",
+			9,
+			45 * time.Second,
+			[activityBuckets]int{0, 0, 0, 5, 1, 0, 0, 3},
+			"   █▁  ▄ 9",
+		},
+		{
+			"window over",
+			9,
+			200 * time.Second,
+			[activityBuckets]int{},
+			"         0",
+		},
+		{
+			"after the window",
+			10,
+			205 * time.Second,
+			[activityBuckets]int{0, 0, 0, 0, 0, 0, 0, 1},
+			"       █ 1",
+		},
+	} {
+		a.update(step.sightings, now.Add(step.at))
+
+		if a.counts != step.counts {
+			t.Fatalf("%s: unexpected counts: %v", step.name, a.counts)
+		}
+		if a.text() != step.text {
+			t.Fatalf("%s: unexpected text: %q", step.name, a.text())
+		}
+	}
+
+	var nilActivity *uiActivity
+	if nilActivity.total() != 0 || nilActivity.text() != "-" {
+		t.Error("unexpected activity of unknown node")
+	}
+}
+
+func TestFreshnessColor(t *testing.T) {
+	for _, ca := range []struct {
+		name  string
+		node  discover.Node
+		color termbox.Attribute
+	}{
+		{"fresh", discover.Node{Online: true, LastSeen: time.Now()}, termbox.ColorGreen},
+		{"stale", discover.Node{Online: true, LastSeen: time.Now().Add(-freshPeriod)}, termbox.ColorYellow},
+		{"offline", discover.Node{LastSeen: time.Now()}, termbox.ColorDarkGray},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			if c := freshnessColor(ca.node); c != ca.color {
+				t.Errorf("expected %v, got %v", ca.color, c)
+			}
+		})
+	}
+}
+
+func TestTimeText(t *testing.T) {
+	abs := time.Date(2024, 3, 5, 14, 7, 9, 0, time.Local)
+
+	for _, ca := range []struct {
+		name     string
+		relative bool
+		t        time.Time
+		text     string
+	}{
+		{"absolute", false, abs, "Mar 5 14:07:09"},
+		{"seconds", true, time.Now().Add(-5 * time.Second), "5s ago"},
+		{"future", true, time.Now().Add(2 * time.Second), "0s ago"},
+		{"minutes", true, time.Now().Add(-90 * time.Second), "1m ago"},
+		{"hours", true, time.Now().Add(-3*time.Hour - time.Minute), "3h ago"},
+		{"days", true, time.Now().Add(-50 * time.Hour), "2d ago"},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			u := &ui{relativeTime: ca.relative}
+			if text := u.timeText(ca.t); text != ca.text {
+				t.Errorf("expected %q, got %q", ca.text, text)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+type uiTableColumn string
+
+// uiColumnKind is the type of the values of a column, that determines how it is sorted.
+type uiColumnKind int
+
+const (
+	uiColumnText uiColumnKind = iota
+	uiColumnTime
+	uiColumnIP
+	uiColumnMAC
+	uiColumnNumber
+)
+
+// uiColumn is a column that can be shown in the table.
+type uiColumn struct {
+	name uiTableColumn
+	kind uiColumnKind
+
+	// text returns the content of the cell.
+	// It is nil for the label column, that depends on the inventory.
+	text func(u *ui, n discover.Node) string
+
+	// key returns the value used to sort the column.
+	// It is nil for text columns, that are sorted by content.
+	key func(u *ui, n discover.Node) interface{}
+}
+
+// uiColumns are the available columns of the table.
+var uiColumns = []uiColumn{
+	{
+		name: "last seen",
+		kind: uiColumnTime,
+		text: func(u *ui, n discover.Node) string { return u.timeText(n.LastSeen) },
+		key:  func(_ *ui, n discover.Node) interface{} { return n.LastSeen },
+	},
+	{
+		name: "first seen",
+		kind: uiColumnTime,
+		text: func(u *ui, n discover.Node) string { return u.timeText(n.FirstSeen) },
+		key:  func(_ *ui, n discover.Node) interface{} { return n.FirstSeen },
+	},
+	{
+		name: "online",
+		text: func(_ *ui, n discover.Node) string {
+			if n.Online {
+				return "online"
+			}
+			return "offline"
+		},
+	},
+	{
+		name: "sightings",
+		kind: uiColumnNumber,
+		text: func(_ *ui, n discover.Node) string { return strconv.Itoa(n.Sightings) },
+		key:  func(_ *ui, n discover.Node) interface{} { return n.Sightings },
+	},
+	{
+		name: "activity",
+		kind: uiColumnNumber,
+		text: func(u *ui, n discover.Node) string { return u.activity[uiNodeID(n)].text() },
+		key:  func(u *ui, n discover.Node) interface{} { return u.activity[uiNodeID(n)].total() },
+	},
+	{
+		name: "method",
+		text: func(_ *ui, n discover.Node) string { return orDash(n.Method) },
+	},
+	{
+		name: "mac",
+		kind: uiColumnMAC,
+		text: func(_ *ui, n discover.Node) string { return n.MAC.String() },
+		key:  func(_ *ui, n discover.Node) interface{} { return n.MAC },
+	},
+	{
+		name: "ip",
+		kind: uiColumnIP,
+		text: func(_ *ui, n discover.Node) string { return n.IP.String() },
+		key:  func(_ *ui, n discover.Node) interface{} { return n.IP },
+	},
+	{
+		name: "vendor",
+		text: func(_ *ui, n discover.Node) string {
+			if n.Gateway {
+				return discover.MacVendor(n.MAC) + " (gateway)"
+			}
+			return discover.MacVendor(n.MAC)
+		},
+	},
+	{
+		name: "hostname",
+		text: func(_ *ui, n discover.Node) string { return orDash(hostname(n)) },
+	},
+	{
+		name: "dns",
+		text: func(_ *ui, n discover.Node) string { return orDash(n.DNS) },
+	},
+	{
+		name: "nbns",
+		text: func(_ *ui, n discover.Node) string { return orDash(n.NBNS) },
+	},
+	{
+		name: "mdns",
+		text: func(_ *ui, n discover.Node) string { return orDash(n.MDNS) },
+	},
+	{
+		name: "os",
+		text: func(_ *ui, n discover.Node) string { return orDash(osGuess(n)) },
+	},
+	{
+		name: "services",
+		text: func(_ *ui, n discover.Node) string { return orDash(servicesText(n.Services)) },
+	},
+	{
+		name: "interface",
+		text: func(_ *ui, n discover.Node) string { return n.Interface },
+	},
+	{
+		name: "vlan",
+		kind: uiColumnNumber,
+		text: func(_ *ui, n discover.Node) string { return vlanText(n.VLAN) },
+		key:  func(_ *ui, n discover.Node) interface{} { return int(n.VLAN) },
+	},
+	{
+		name: "label",
+	},
+}
+
+// uiDefaultColumns are the columns shown when they are not configured.
+// The interface column is added when there are multiple interfaces,
+// the vlan column when a tagged node is found,
+// the label column when an inventory is provided.
+var uiDefaultColumns = []uiTableColumn{
+	"last seen",
+	"mac",
+	"ip",
+	"vendor",
+	"dns",
+	"nbns",
+	"mdns",
+	"activity",
+}
+
+func uiColumnNames() []string {
+	ret := make([]string, len(uiColumns))
+	for i, c := range uiColumns {
+		ret[i] = string(c.name)
+	}
+	return ret
+}
+
+func findUIColumn(name uiTableColumn) (uiColumn, bool) {
+	i := slices.IndexFunc(uiColumns, func(c uiColumn) bool { return c.name == name })
+	if i < 0 {
+		return uiColumn{}, false
+	}
+	return uiColumns[i], true
+}
+
+func validateColumns(columns []string) error {
+	for _, col := range columns {
+		if _, ok := findUIColumn(uiTableColumn(col)); !ok {
+			return fmt.Errorf("invalid column: %s", col)
+		}
+	}
+	return nil
+}
+
+// compare compares two sort keys of the column.
+func (c uiColumn) compare(a interface{}, b interface{}) int {
+	switch c.kind {
+	case uiColumnTime:
+		return a.(time.Time).Compare(b.(time.Time))
+
+	case uiColumnIP:
+		return bytes.Compare(a.(net.IP).To16(), b.(net.IP).To16())
+
+	case uiColumnMAC:
+		return bytes.Compare(a.(net.HardwareAddr), b.(net.HardwareAddr))
+
+	case uiColumnNumber:
+		return cmp.Compare(a.(int), b.(int))
+	}
+
+	return strings.Compare(a.(string), b.(string))
+}
+
+// osGuess guesses the operating system of a node from the services it announces,
+// its vendor and the TTL of its NetBIOS replies, whose initial value depends
+// on the operating system. It returns an empty string when there are no hints.
+func osGuess(n discover.Node) string {
+	switch {
+	case slices.Contains(n.Services, "_ipp._tcp") ||
+		slices.Contains(n.Services, "_printer._tcp") ||
+		slices.Contains(n.Services, "_pdl-datastream._tcp"):
+		return "printer"
+
+	case strings.HasPrefix(discover.MacVendor(n.MAC), "Apple"):
+		return "macOS/iOS"
+
+	case n.TTL > 128:
+		return "network device"
+
+	case n.TTL > 64:
+		return "Windows"
+
+	case n.TTL > 0:
+		return "Linux/Unix"
+	}
+
+	return ""
+}
+
+// servicesText returns the service types of a node in short form, like "http, ipp".
+func servicesText(services []string) string {
+	names := make([]string, len(services))
+	for i, s := range services {
+		s = strings.TrimPrefix(s, "_")
+		s = strings.TrimSuffix(s, "._tcp")
+		names[i] = strings.Replace(s, "._udp", "/udp", 1)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestColumnCompare(t *testing.T) {
+	now := time.Now()
+
+	for _, ca := range []struct {
+		name string
+		kind uiColumnKind
+		a    interface{}
+		b    interface{}
+		res  int
+	}{
+		{"time", uiColumnTime, now.Add(-time.Minute), now, -1},
+		{"time equal", uiColumnTime, now, now, 0},
+		{"ip", uiColumnIP, net.ParseIP("10.0.0.9").To4(), net.ParseIP("10.0.0.10").To4(), -1},
+		{"ip mixed lengths", uiColumnIP, net.ParseIP("10.0.1.1"), net.ParseIP("10.0.0.200").To4(), 1},
+		{"mac", uiColumnMAC, mustParseMAC(t, "00:11:22:33:44:0a"), mustParseMAC(t, "00:11:22:33:44:09"), 1},
+		{"number", uiColumnNumber, 9, 10, -1},
+		{"number equal", uiColumnNumber, 10, 10, 0},
+		{"text", uiColumnText, "10", "9", -1},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			res := uiColumn{kind: ca.kind}.compare(ca.a, ca.b)
+			if res != ca.res {
+				t.Errorf("expected %d, got %d", ca.res, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+// uiFilterTerm checks whether a node, shown with the given cells, matches a term.
+type uiFilterTerm func(n discover.Node, cells []string) bool
+
+// uiFilter is a filter of the table.
+// It is made of terms separated by spaces, that must all match:
+//
+//	vendor:apple     vendor contains "apple"
+//	mac:00:11        MAC address contains "00:11"
+//	ip:10.0.1.0/24   IP is in the subnet (an IP or a part of it is accepted too)
+//	name:printer     DNS, NetBIOS or mDNS name contains "printer"
+//	online, offline  node is online or offline
+//	text             any cell contains "text"
+//
+// Comparisons are case-insensitive.
+type uiFilter struct {
+	expr  string
+	terms []uiFilterTerm
+}
+
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), substr)
+}
+
+func parseUIFilter(expr string) uiFilter {
+	f := uiFilter{expr: expr}
+
+	for _, word := range strings.Fields(strings.ToLower(expr)) {
+		key, value, ok := strings.Cut(word, ":")
+
+		switch {
+		case word == "online":
+			f.terms = append(f.terms, func(n discover.Node, _ []string) bool {
+				return n.Online
+			})
+
+		case word == "offline":
+			f.terms = append(f.terms, func(n discover.Node, _ []string) bool {
+				return !n.Online
+			})
+
+		case ok && key == "vendor":
+			f.terms = append(f.terms, func(n discover.Node, _ []string) bool {
+				return containsFold(discover.MacVendor(n.MAC), value)
+			})
+
+		case ok && key == "mac":
+			f.terms = append(f.terms, func(n discover.Node, _ []string) bool {
+				return strings.Contains(n.MAC.String(), value)
+			})
+
+		case ok && key == "ip":
+			f.terms = append(f.terms, ipFilterTerm(value))
+
+		case ok && key == "name":
+			f.terms = append(f.terms, func(n discover.Node, _ []string) bool {
+				return containsFold(n.DNS, value) ||
+					containsFold(n.NBNS, value) ||
+					containsFold(n.MDNS, value)
+			})
+
+		default:
+			f.terms = append(f.terms, func(_ discover.Node, cells []string) bool {
+				for _, cell := range cells {
+					if containsFold(cell, word) {
+						return true
+					}
+				}
+				return false
+			})
+		}
+	}
+
+	return f
+}
+
+// ipFilterTerm matches IPs in a subnet, equal to an IP,
+// or containing the value while it is being typed.
+func ipFilterTerm(value string) uiFilterTerm {
+	if _, ipnet, err := net.ParseCIDR(value); err == nil {
+		return func(n discover.Node, _ []string) bool {
+			return ipnet.Contains(n.IP)
+		}
+	}
+
+	if ip := net.ParseIP(value); ip != nil {
+		return func(n discover.Node, _ []string) bool {
+			return ip.Equal(n.IP)
+		}
+	}
+
+	return func(n discover.Node, _ []string) bool {
+		return strings.Contains(n.IP.String(), value)
+	}
+}
+
+func (f uiFilter) active() bool {
+	return len(f.terms) != 0
+}
+
+func (f uiFilter) match(n discover.Node, cells []string) bool {
+	for _, term := range f.terms {
+		if !term(n, cells) {
+			return false
+		}
+	}
+	return true
+}
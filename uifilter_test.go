@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/aler9/landiscover/pkg/discover"
+)
+
+func TestParseUIFilter(t *testing.T) {
+	nodes := map[string]discover.Node{
+		"mac": {
+			MAC:    mustParseMAC(t, "00:03:93:aa:bb:01"),
+			IP:     net.ParseIP("10.0.1.5").To4(),
+			MDNS:   "MacBook.local",
+			Online: true,
+		},
+		"pi": {
+			MAC:    mustParseMAC(t, "b8:27:eb:00:00:02"),
+			IP:     net.ParseIP("10.0.1.50").To4(),
+			DNS:    "pi.lan",
+			Online: true,
+		},
+		"vm": {
+			MAC:  mustParseMAC(t, "00:50:56:00:00:03"),
+			IP:   net.ParseIP("10.0.2.5").To4(),
+			NBNS: "PRINTSRV",
+		},
+	}
+
+	// cells are the ones of the table, including columns that are not node fields
+	cells := map[string][]string{
+		"mac": {"00:03:93:aa:bb:01", "10.0.1.5", "laptop"},
+		"pi":  {"b8:27:eb:00:00:02", "10.0.1.50", "-"},
+		"vm":  {"00:50:56:00:00:03", "10.0.2.5", "print server"},
+	}
+
+	for _, ca := range []struct {
+		name    string
+		expr    string
+		matches string
+	}{
+		{"empty", "  ", "mac,pi,vm"},
+		{"vendor", "vendor:apple", "mac"},
+		{"vendor case", "VENDOR:Raspberry", "pi"},
+		{"mac", "mac:00:50", "vm"},
+		{"mac case", "mac:AA:BB", "mac"},
+		{"ip cidr", "ip:10.0.1.0/24", "mac,pi"},
+		{"ip full", "ip:10.0.1.5", "mac"},
+		{"ip substring", "ip:10.0.1.", "mac,pi"},
+		{"ip substring end", "ip:.5", "mac,pi,vm"},
+		{"name dns", "name:pi.", "pi"},
+		{"name nbns", "name:printsrv", "vm"},
+		{"name mdns", "name:macbook", "mac"},
+		{"online", "online", "mac,pi"},
+		{"offline", "offline", "vm"},
+		{"free text", "laptop", "mac"},
+		{"free text cells", "server", "vm"},
+		{"all terms", "online ip:10.0.1.0/24 name:pi", "pi"},
+		{"no match", "online vendor:vmware", ""},
+		{"empty value", "ip:", "mac,pi,vm"},
+		{"invalid cidr", "ip:10.0.1.0/33", ""},
+		{"unknown key", "os:linux", ""},
+		{"unknown key in cells", "print:", ""},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			f := parseUIFilter(ca.expr)
+
+			if f.expr != ca.expr {
+				t.Errorf("unexpected expression: %q", f.expr)
+			}
+
+			var matches []string
+			for _, name := range []string{"mac", "pi", "vm"} {
+				if !f.active() || f.match(nodes[name], cells[name]) {
+					matches = append(matches, name)
+				}
+			}
+
+			if strings.Join(matches, ",") != ca.matches {
+				t.Errorf("expected %q, got %q", ca.matches, strings.Join(matches, ","))
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/nsf/termbox-go"
+)
+
+// shiftEnterSequences are the sequences that terminals send for Shift+Enter
+// when they distinguish it from Enter (CSI u and xterm modifyOtherKeys), and
+// Alt+Enter, that is accepted in its place by the other terminals.
+// termbox does not know them, therefore input is read raw and these are
+// recognized before passing the rest to termbox.
+var shiftEnterSequences = [][]byte{
+	[]byte("\x1b[13;2u"),
+	[]byte("\x1b[27;2;13~"),
+	[]byte("\x1b\r"),
+}
+
+// uiInputEvent is a terminal event.
+type uiInputEvent struct {
+	tevt  termbox.Event
+	shift bool
+}
+
+// parseInput splits raw input into events.
+func parseInput(data []byte) []uiInputEvent {
+	var ret []uiInputEvent
+
+outer:
+	for len(data) != 0 {
+		for _, seq := range shiftEnterSequences {
+			if bytes.HasPrefix(data, seq) {
+				ret = append(ret, uiInputEvent{
+					tevt:  termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter},
+					shift: true,
+				})
+				data = data[len(seq):]
+				continue outer
+			}
+		}
+
+		tevt := termbox.ParseEvent(data)
+		if tevt.N == 0 {
+			break
+		}
+		data = data[tevt.N:]
+
+		if tevt.Type != termbox.EventNone {
+			ret = append(ret, uiInputEvent{tevt: tevt})
+		}
+	}
+
+	return ret
+}
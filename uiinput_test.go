@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestParseInput(t *testing.T) {
+	type event struct {
+		typ   termbox.EventType
+		key   termbox.Key
+		ch    rune
+		shift bool
+	}
+
+	enter := event{termbox.EventKey, termbox.KeyEnter, 0, false}
+	shiftEnter := event{termbox.EventKey, termbox.KeyEnter, 0, true}
+
+	for _, ca := range []struct {
+		name   string
+		data   string
+		events []event
+	}{
+		{"enter", "\r", []event{enter}},
+		{"csi u", "\x1b[13;2u", []event{shiftEnter}},
+		{"modify other keys", "\x1b[27;2;13~", []event{shiftEnter}},
+		{"alt enter", "\x1b\r", []event{shiftEnter}},
+		{
+			"mixed",
+			"a\x1b[13;2u\rb\x1b\r",
+			[]event{
+				{termbox.EventKey, 0, 'a', false},
+				shiftEnter,
+				enter,
+				{termbox.EventKey, 0, 'b', false},
+				shiftEnter,
+			},
+		},
+		{
+			"mouse",
+			"\x1b[<0;5;3M\x1b[13;2u",
+			[]event{{termbox.EventMouse, termbox.MouseLeft, 0, false}, shiftEnter},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var events []event
+			for _, evt := range parseInput([]byte(ca.data)) {
+				events = append(events, event{evt.tevt.Type, evt.tevt.Key, evt.tevt.Ch, evt.shift})
+			}
+
+			if !reflect.DeepEqual(events, ca.events) {
+				t.Errorf("unexpected events: %+v", events)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+const (
+	doubleClickDuration = 400 * time.Millisecond
+	wheelRows           = 3
+)
+
+// uiScrollbar is the position of a scrollbar drawn by drawScrollbar.
+type uiScrollbar struct {
+	origin int // first cell of the scrollbar
+	start  int // first cell of the bar
+	size   int // cells of the bar
+	zone   int // cells in which the bar can move
+	minVal int // scroll value when the bar is at the end
+}
+
+// contains returns whether a cell is inside the scrollbar.
+func (b uiScrollbar) contains(pos int) bool {
+	return pos >= b.origin && pos < b.origin+b.zone+b.size
+}
+
+// value returns the scroll value that moves the bar to pos.
+// It is the inverse of the computation of drawScrollbar.
+func (b uiScrollbar) value(pos int) int {
+	if b.zone <= 0 || b.minVal >= 0 {
+		return 0
+	}
+
+	// round up, since drawScrollbar rounds down the offset of the bar
+	pos = min(max(pos-b.origin, 0), b.zone)
+	return b.minVal + ((b.zone-pos)*(-b.minVal)+b.zone-1)/b.zone
+}
+
+// uiLayoutColumn is the position of a column header.
+type uiLayoutColumn struct {
+	name uiTableColumn
+	x    [2]int // first cell and cell after the last one
+}
+
+// uiTableLayout is the position of the table on the screen. It is saved
+// when the table is drawn, in order to find the target of mouse events.
+type uiTableLayout struct {
+	vbarX     int
+	hbarY     int
+	headerY   int
+	firstRowY int    // row of the first table row, that may be scrolled out
+	rowsY     [2]int // first and last visible rows
+	columns   []uiLayoutColumn
+	vbar      uiScrollbar
+	hbar      uiScrollbar
+}
+
+// uiDrag is a scrollbar that is being dragged.
+type uiDrag struct {
+	active   bool
+	vertical bool
+	offset   int // position of the pointer relative to the start of the bar
+}
+
+// uiClick is the last click on a row, used to detect double clicks.
+type uiClick struct {
+	row  string
+	time time.Time
+}
+
+// onMouse handles a mouse event. The column picker and the prompt
+// are used with the keyboard only.
+func (u *ui) onMouse(tevt termbox.Event) {
+	if u.prompt != nil || u.picker {
+		return
+	}
+
+	l := u.tableLayout
+
+	switch {
+	case tevt.Key == termbox.MouseRelease:
+		u.drag = uiDrag{}
+
+	case tevt.Key == termbox.MouseWheelUp:
+		u.onScrollY(u.tableScrollY + wheelRows)
+
+	case tevt.Key == termbox.MouseWheelDown:
+		u.onScrollY(u.tableScrollY - wheelRows)
+
+	case tevt.Key != termbox.MouseLeft:
+
+	case (tevt.Mod & termbox.ModMotion) != 0:
+		if u.drag.active {
+			u.onDrag(tevt)
+		}
+
+	case u.detail != "":
+		u.detail = ""
+
+	case tevt.MouseX == l.vbarX && l.vbar.contains(tevt.MouseY):
+		u.onStartDrag(true, l.vbar, tevt)
+
+	case tevt.MouseY == l.hbarY && l.hbar.contains(tevt.MouseX):
+		u.onStartDrag(false, l.hbar, tevt)
+
+	case tevt.MouseY == l.headerY:
+		i := slices.IndexFunc(l.columns, func(c uiLayoutColumn) bool {
+			return tevt.MouseX >= c.x[0] && tevt.MouseX < c.x[1]
+		})
+		if i >= 0 {
+			u.selection = "col_" + string(l.columns[i].name)
+			u.onSort(l.columns[i].name, false)
+		}
+
+	case tevt.MouseY >= l.rowsY[0] && tevt.MouseY <= l.rowsY[1]:
+		i := tevt.MouseY - l.firstRowY
+		if i < 0 || i >= len(u.tableRows) {
+			return
+		}
+
+		id := u.tableRows[i].id
+		u.selection = "row_" + id
+
+		if u.lastClick.row == id && time.Since(u.lastClick.time) < doubleClickDuration {
+			u.detail = id
+			u.lastClick = uiClick{}
+			return
+		}
+		u.lastClick = uiClick{row: id, time: time.Now()}
+	}
+}
+
+// onStartDrag starts dragging a scrollbar. Clicking outside the bar
+// moves its middle under the pointer.
+func (u *ui) onStartDrag(vertical bool, bar uiScrollbar, tevt termbox.Event) {
+	pos := tevt.MouseX
+	if vertical {
+		pos = tevt.MouseY
+	}
+
+	u.drag = uiDrag{
+		active:   true,
+		vertical: vertical,
+		offset:   pos - bar.start,
+	}
+
+	if pos < bar.start || pos >= bar.start+bar.size {
+		u.drag.offset = bar.size / 2
+		u.onDrag(tevt)
+	}
+}
+
+func (u *ui) onDrag(tevt termbox.Event) {
+	if u.drag.vertical {
+		u.onScrollY(u.tableLayout.vbar.value(tevt.MouseY - u.drag.offset))
+	} else {
+		u.tableScrollX = u.tableLayout.hbar.value(tevt.MouseX - u.drag.offset)
+	}
+}
+
+// onScrollY scrolls the table vertically. Since the table is always scrolled
+// in order to show the selected row, the selection is moved to the nearest visible row.
+func (u *ui) onScrollY(value int) {
+	visible := u.tableLayout.rowsY[1] - u.tableLayout.rowsY[0] + 1
+	if len(u.tableRows) == 0 || visible <= 0 {
+		return
+	}
+
+	u.tableScrollY = min(max(value, visible-len(u.tableRows)), 0)
+
+	first := -u.tableScrollY
+	last := min(first+visible-1, len(u.tableRows)-1)
+
+	i := slices.IndexFunc(u.tableRows, func(row uiTableRow) bool {
+		return u.selection == "row_"+row.id
+	})
+	switch {
+	case i < first:
+		i = first
+	case i > last:
+		i = last
+	}
+
+	u.selection = "row_" + u.tableRows[i].id
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// newTestMouseUI returns a ui with 20 rows, of which 5 are visible
+// starting from the screen row 2.
+func newTestMouseUI() *ui {
+	u := &ui{}
+	for i := 0; i < 20; i++ {
+		u.tableRows = append(u.tableRows, uiTableRow{id: fmt.Sprintf("%d", i)})
+	}
+	u.tableLayout = uiTableLayout{
+		headerY:   0,
+		firstRowY: 2,
+		rowsY:     [2]int{2, 6},
+	}
+	return u
+}
+
+func testMouseEvent(key termbox.Key, x int, y int) termbox.Event {
+	return termbox.Event{Type: termbox.EventMouse, Key: key, MouseX: x, MouseY: y}
+}
+
+func TestUIMouseDoubleClick(t *testing.T) {
+	for _, ca := range []struct {
+		name   string
+		second int
+		pause  time.Duration
+		detail string
+	}{
+		{"double click", 3, 0, "1"},
+		{"within window", 3, doubleClickDuration - 100*time.Millisecond, "1"},
+		{"after window", 3, doubleClickDuration, ""},
+		{"another row", 4, 0, ""},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			u := newTestMouseUI()
+
+			u.onMouse(testMouseEvent(termbox.MouseLeft, 5, 3))
+			if u.selection != "row_1" || u.detail != "" {
+				t.Fatalf("unexpected state after first click: %q %q", u.selection, u.detail)
+			}
+
+			u.lastClick.time = u.lastClick.time.Add(-ca.pause)
+
+			u.onMouse(testMouseEvent(termbox.MouseLeft, 5, ca.second))
+			if u.detail != ca.detail {
+				t.Errorf("expected detail %q, got %q", ca.detail, u.detail)
+			}
+		})
+	}
+
+	// a third click does not open the detail again
+	u := newTestMouseUI()
+	for i := 0; i < 3; i++ {
+		u.onMouse(testMouseEvent(termbox.MouseLeft, 5, 3))
+		if i == 1 {
+			u.detail = ""
+		}
+	}
+	if u.detail != "" {
+		t.Errorf("unexpected detail: %q", u.detail)
+	}
+}
+
+func TestUIMouseWheel(t *testing.T) {
+	u := newTestMouseUI()
+	u.selection = "row_0"
+
+	for _, step := range []struct {
+		key       termbox.Key
+		scrollY   int
+		selection string
+	}{
+		{termbox.MouseWheelDown, -3, "row_3"},
+		{termbox.MouseWheelDown, -6, "row_6"},
+		{termbox.MouseWheelUp, -3, "row_6"},
+		{termbox.MouseWheelUp, 0, "row_4"},
+		{termbox.MouseWheelUp, 0, "row_4"},
+		{termbox.MouseWheelDown, -3, "row_4"},
+		{termbox.MouseWheelDown, -6, "row_6"},
+		{termbox.MouseWheelDown, -9, "row_9"},
+		{termbox.MouseWheelDown, -12, "row_12"},
+		{termbox.MouseWheelDown, -15, "row_15"},
+		{termbox.MouseWheelDown, -15, "row_15"},
+	} {
+		u.onMouse(testMouseEvent(step.key, 0, 0))
+
+		if u.tableScrollY != step.scrollY || u.selection != step.selection {
+			t.Fatalf("expected %d %s, got %d %s", step.scrollY, step.selection, u.tableScrollY, u.selection)
+		}
+	}
+}
+
+func TestUIScrollbar(t *testing.T) {
+	u := &ui{}
+
+	for _, ca := range []struct {
+		name       string
+		screenSize int
+		pageSize   int
+	}{
+		{"short bar", 11, 40},
+		{"long bar", 11, 12},
+		{"zone larger than page", 21, 25},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			first := u.drawScrollbar(true, 0, 4, ca.screenSize, ca.pageSize, 0)
+			last := u.drawScrollbar(true, 0, 4, ca.screenSize, ca.pageSize, first.minVal)
+
+			if first.start != first.origin || last.start != last.origin+last.zone {
+				t.Fatalf("unexpected bars: %+v %+v", first, last)
+			}
+
+			for _, pos := range []struct {
+				pos   int
+				value int
+			}{
+				{first.origin - 1, 0},
+				{first.origin, 0},
+				{first.origin + first.zone, first.minVal},
+				{first.origin + first.zone + 1, first.minVal},
+			} {
+				if v := first.value(pos.pos); v != pos.value {
+					t.Errorf("position %d: expected %d, got %d", pos.pos, pos.value, v)
+				}
+			}
+
+			// the value of every position moves the bar to that position
+			for pos := first.origin; pos <= first.origin+first.zone; pos++ {
+				v := first.value(pos)
+				if v > 0 || v < first.minVal {
+					t.Fatalf("position %d: value %d out of range", pos, v)
+				}
+
+				bar := u.drawScrollbar(true, 0, 4, ca.screenSize, ca.pageSize, v)
+				if bar.start != pos {
+					t.Errorf("position %d: value %d moves the bar to %d", pos, v, bar.start)
+				}
+			}
+		})
+	}
+
+	// a table that fits the screen can't be scrolled
+	bar := u.drawScrollbar(true, 0, 4, 11, 5, 0)
+	if bar.value(bar.origin) != 0 || bar.value(bar.origin+5) != 0 {
+		t.Errorf("unexpected values: %+v", bar)
+	}
+}
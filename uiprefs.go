@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// uiSortKey is a column the table is sorted by.
+type uiSortKey struct {
+	Column uiTableColumn `json:"column"`
+	Asc    bool          `json:"asc"`
+}
+
+// uiPrefs are the preferences of the terminal interface that are remembered between runs.
+type uiPrefs struct {
+	Sort         []uiSortKey `json:"sort"`
+	RelativeTime bool        `json:"relativeTime"`
+}
+
+// uiPrefsPath returns the path of the preferences file, that is placed
+// near the default configuration file.
+func uiPrefsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "landiscover", "ui.json"), nil
+}
+
+// loadUIPrefs reads the preferences. Missing or invalid preferences are ignored.
+func loadUIPrefs() uiPrefs {
+	var p uiPrefs
+
+	fpath, err := uiPrefsPath()
+	if err != nil {
+		return p
+	}
+
+	byts, err := os.ReadFile(fpath)
+	if err != nil {
+		return p
+	}
+
+	json.Unmarshal(byts, &p) //nolint:errcheck
+	return p
+}
+
+func (p uiPrefs) save() error {
+	fpath, err := uiPrefsPath()
+	if err != nil {
+		return err
+	}
+
+	byts, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fpath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fpath, append(byts, '\n'), 0o644)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUIPrefs(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	// missing preferences are ignored
+	if p := loadUIPrefs(); !reflect.DeepEqual(p, uiPrefs{}) {
+		t.Fatalf("unexpected preferences: %+v", p)
+	}
+
+	p := uiPrefs{
+		Sort:         []uiSortKey{{Column: "last seen", Asc: false}, {Column: "ip", Asc: true}},
+		RelativeTime: true,
+	}
+
+	err := p.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fpath := filepath.Join(dir, "landiscover", "ui.json")
+	if _, err := os.Stat(fpath); err != nil {
+		t.Fatal(err)
+	}
+
+	if p2 := loadUIPrefs(); !reflect.DeepEqual(p2, p) {
+		t.Errorf("unexpected preferences: %+v", p2)
+	}
+
+	// invalid preferences are ignored
+	writeTestFile(t, fpath, "{")
+	if p := loadUIPrefs(); !reflect.DeepEqual(p, uiPrefs{}) {
+		t.Errorf("unexpected preferences: %+v", p)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// uiMaxCellWidth is the maximum width of a column. Longer cells are truncated.
+const uiMaxCellWidth = 40
+
+// uiCell is a character placed on a row of the screen.
+type uiCell struct {
+	x  int
+	ch rune
+}
+
+// sanitizeText replaces control characters, that would move the cursor
+// or alter the terminal, with a visible placeholder.
+func sanitizeText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, text)
+}
+
+// textWidth returns the number of terminal cells occupied by a text,
+// that differs from its length when it contains multibyte or wide characters.
+func textWidth(text string) int {
+	return runewidth.StringWidth(sanitizeText(text))
+}
+
+// truncateText shortens a text to the given width, ending it with an ellipsis.
+func truncateText(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.Truncate(sanitizeText(text), width, "…")
+}
+
+// clipText places the characters of a text starting from x, and keeps the ones
+// that fit entirely between startX and endX.
+func clipText(startX int, endX int, x int, text string) []uiCell {
+	var ret []uiCell
+
+	for _, r := range sanitizeText(text) {
+		// wide characters occupy two cells, combining characters none
+		w := runewidth.RuneWidth(r)
+		if w == 0 {
+			continue
+		}
+
+		if x >= startX && x+w-1 <= endX {
+			ret = append(ret, uiCell{x, r})
+		}
+		x += w
+	}
+
+	return ret
+}
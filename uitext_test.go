@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTextWidth(t *testing.T) {
+	for _, ca := range []struct {
+		name  string
+		text  string
+		width int
+	}{
+		{"empty", "", 0},
+		{"ascii", "printer", 7},
+		{"accents", "Küche", 5},
+		{"cjk", "電視", 4},
+		{"emoji", "🙂x", 3},
+		{"combining mark", "e\u0301", 1},
+		{"control characters", "a\x1b[2J", 5},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			if w := textWidth(ca.text); w != ca.width {
+				t.Errorf("expected %d, got %d", ca.width, w)
+			}
+		})
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	for _, ca := range []struct {
+		name  string
+		text  string
+		width int
+		out   string
+	}{
+		{"fits", "printer", 7, "printer"},
+		{"ascii", "printer", 5, "prin…"},
+		{"cjk", "電視機", 5, "電視…"},
+		{"straddling", "ab電視", 4, "ab…"},
+		{"emoji", "🙂🙂", 3, "🙂…"},
+		{"combining mark", "e\u0301xyz", 2, "e\u0301…"},
+		{"control characters", "a\x1bbcd", 3, "a?…"},
+		{"width 1", "電視", 1, "…"},
+		{"width 0", "printer", 0, ""},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			out := truncateText(ca.text, ca.width)
+			if out != ca.out {
+				t.Errorf("expected %q, got %q", ca.out, out)
+			}
+			if textWidth(out) > ca.width {
+				t.Errorf("text is %d cells wide", textWidth(out))
+			}
+		})
+	}
+}
+
+func TestClipText(t *testing.T) {
+	for _, ca := range []struct {
+		name   string
+		startX int
+		endX   int
+		x      int
+		text   string
+		cells  []uiCell
+	}{
+		{
+			"inside",
+			0, 9, 2,
+			"ab",
+			[]uiCell{{2, 'a'}, {3, 'b'}},
+		},
+		{
+			"clipped at both ends",
+			2, 3, 1,
+			"abcd",
+			[]uiCell{{2, 'b'}, {3, 'c'}},
+		},
+		{
+			"wide characters",
+			0, 9, 0,
+			"電a",
+			[]uiCell{{0, '電'}, {2, 'a'}},
+		},
+		{
+			"wide character straddling the end",
+			0, 2, 0,
+			"a電b",
+			[]uiCell{{0, 'a'}, {1, '電'}},
+		},
+		{
+			"wide character straddling the start",
+			1, 9, 0,
+			"電a",
+			[]uiCell{{2, 'a'}},
+		},
+		{
+			"combining mark",
+			0, 9, 0,
+			"e\u0301x",
+			[]uiCell{{0, 'e'}, {1, 'x'}},
+		},
+		{
+			"control characters",
+			0, 9, 0,
+			"a\x1b\rb",
+			[]uiCell{{0, 'a'}, {1, '?'}, {2, '?'}, {3, 'b'}},
+		},
+		{
+			"empty area",
+			5, 4, 0,
+			"abcdef",
+			nil,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			cells := clipText(ca.startX, ca.endX, ca.x, ca.text)
+			if !reflect.DeepEqual(cells, ca.cells) {
+				t.Errorf("unexpected cells: %v", cells)
+			}
+		})
+	}
+}